@@ -0,0 +1,214 @@
+package closuretree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrLeafNotFound is returned when a leaf does not exist or belongs to another tenant.
+var ErrLeafNotFound = errors.New("leaf not found")
+
+// LeafLinkOf is a single attachment of a leaf to a node, i.e. a row of the many2many join table.
+type LeafLinkOf[K ID] struct {
+	LeafID uint
+	NodeID K
+}
+
+// LeafLink is the LeafLinkOf of trees with uint IDs.
+type LeafLink = LeafLinkOf[uint]
+
+// AttachLeaf attaches the leaf leafID of type leafModel, e.g. Book{}, to the node nodeID.
+// Both must belong to tenant; attaching a leaf that is already attached is a no-op.
+func (ct *TreeOf[K]) AttachLeaf(ctx context.Context, leafModel any, leafID uint, nodeID K, tenant string) error {
+	return ct.AttachLeaves(ctx, leafModel, []LeafLinkOf[K]{{LeafID: leafID, NodeID: nodeID}}, tenant)
+}
+
+// AttachLeaves attaches leaves to nodes in a single transaction, see AttachLeaf.
+func (ct *TreeOf[K]) AttachLeaves(ctx context.Context, leafModel any, links []LeafLinkOf[K], tenant string) error {
+	join, tenant, err := ct.prepareLeafLinks(leafModel, tenant)
+	if err != nil {
+		return err
+	}
+	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ct.checkLeafLinks(tx, join, links, tenant); err != nil {
+			return err
+		}
+		return insertLeafLinks(tx, join, links)
+	})
+}
+
+// DetachLeaf removes the attachment of the leaf leafID of type leafModel from the node nodeID.
+// Both must belong to tenant; detaching a leaf that is not attached is a no-op.
+func (ct *TreeOf[K]) DetachLeaf(ctx context.Context, leafModel any, leafID uint, nodeID K, tenant string) error {
+	return ct.DetachLeaves(ctx, leafModel, []LeafLinkOf[K]{{LeafID: leafID, NodeID: nodeID}}, tenant)
+}
+
+// DetachLeaves detaches leaves from nodes in a single transaction, see DetachLeaf.
+func (ct *TreeOf[K]) DetachLeaves(ctx context.Context, leafModel any, links []LeafLinkOf[K], tenant string) error {
+	join, tenant, err := ct.prepareLeafLinks(leafModel, tenant)
+	if err != nil {
+		return err
+	}
+	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ct.checkLeafLinks(tx, join, links, tenant); err != nil {
+			return err
+		}
+		for _, l := range links {
+			err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = ? AND %s = ?`, join.joinTbl, join.leafCol, join.nodeCol),
+				l.LeafID, l.NodeID).Error
+			if err != nil {
+				return fmt.Errorf("unable to detach leaf %d from node %v: %w", l.LeafID, l.NodeID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// SetLeafNodes replaces the nodes the leaf leafID of type leafModel is attached to with nodeIDs,
+// an empty nodeIDs detaches the leaf from all nodes.
+func (ct *TreeOf[K]) SetLeafNodes(ctx context.Context, leafModel any, leafID uint, nodeIDs []K, tenant string) error {
+	return ct.SetLeavesNodes(ctx, leafModel, map[uint][]K{leafID: nodeIDs}, tenant)
+}
+
+// SetLeavesNodes replaces the nodes of several leaves in a single transaction, nodesByLeaf maps
+// every leaf ID to its new set of node IDs, see SetLeafNodes.
+func (ct *TreeOf[K]) SetLeavesNodes(ctx context.Context, leafModel any, nodesByLeaf map[uint][]K, tenant string) error {
+	join, tenant, err := ct.prepareLeafLinks(leafModel, tenant)
+	if err != nil {
+		return err
+	}
+	var links []LeafLinkOf[K]
+	leafIDs := make([]uint, 0, len(nodesByLeaf))
+	for leafID, nodeIDs := range nodesByLeaf {
+		leafIDs = append(leafIDs, leafID)
+		for _, nodeID := range nodeIDs {
+			links = append(links, LeafLinkOf[K]{LeafID: leafID, NodeID: nodeID})
+		}
+	}
+	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ct.checkLeafIDs(tx, join, leafIDs, tenant); err != nil {
+			return err
+		}
+		if err := ct.checkLeafLinks(tx, join, links, tenant); err != nil {
+			return err
+		}
+		err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s IN ?`, join.joinTbl, join.leafCol), leafIDs).Error
+		if err != nil {
+			return fmt.Errorf("unable to detach leaves: %w", err)
+		}
+		return insertLeafLinks(tx, join, links)
+	})
+}
+
+// prepareLeafLinks resolves the join table of leafModel and validates the tenant.
+func (ct *TreeOf[K]) prepareLeafLinks(leafModel any, tenant string) (leafJoin, string, error) {
+	tenant, err := validateTenant(tenant)
+	if err != nil {
+		return leafJoin{}, "", err
+	}
+	join, err := ct.resolveLeafJoin(leafModel)
+	if err != nil {
+		return leafJoin{}, "", err
+	}
+	return join, tenant, nil
+}
+
+// checkLeafLinks returns ErrLeafNotFound or ErrNodeNotFound if any leaf or node of links does not
+// exist in tenant.
+func (ct *TreeOf[K]) checkLeafLinks(tx *gorm.DB, join leafJoin, links []LeafLinkOf[K], tenant string) error {
+	leafIDs := make([]uint, 0, len(links))
+	nodeIDs := make([]K, 0, len(links))
+	for _, l := range links {
+		leafIDs = append(leafIDs, l.LeafID)
+		nodeIDs = append(nodeIDs, l.NodeID)
+	}
+	if err := ct.checkLeafIDs(tx, join, leafIDs, tenant); err != nil {
+		return err
+	}
+	nodeIDs = uniqueIDs(nodeIDs)
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	var count int64
+	err := tx.Table(ct.nodesTbl).Where("node_id IN ? AND tenant = ?", nodeIDs, tenant).Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("unable to check nodes: %w", err)
+	}
+	if count != int64(len(nodeIDs)) {
+		return ErrNodeNotFound
+	}
+	return nil
+}
+
+// checkLeafIDs returns ErrLeafNotFound if any of leafIDs does not exist in tenant.
+func (ct *TreeOf[K]) checkLeafIDs(tx *gorm.DB, join leafJoin, leafIDs []uint, tenant string) error {
+	leafIDs = uniqueIDs(leafIDs)
+	if len(leafIDs) == 0 {
+		return nil
+	}
+	var count int64
+	err := tx.Table(join.leafTbl).
+		Where(fmt.Sprintf("%s IN ? AND %s = ?", leafIDDBField, leafTenantDBField), leafIDs, tenant).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("unable to check leaves: %w", err)
+	}
+	if count != int64(len(leafIDs)) {
+		return ErrLeafNotFound
+	}
+	return nil
+}
+
+// insertLeafLinks inserts the join rows of links that do not exist yet.
+func insertLeafLinks[K ID](tx *gorm.DB, join leafJoin, links []LeafLinkOf[K]) error {
+	if len(links) == 0 {
+		return nil
+	}
+	leafIDs := make([]uint, 0, len(links))
+	for _, l := range links {
+		leafIDs = append(leafIDs, l.LeafID)
+	}
+	var existing []LeafLinkOf[K]
+	err := tx.Table(join.joinTbl).
+		Select(fmt.Sprintf("%s AS leaf_id, %s AS node_id", join.leafCol, join.nodeCol)).
+		Where(fmt.Sprintf("%s IN ?", join.leafCol), uniqueIDs(leafIDs)).
+		Scan(&existing).Error
+	if err != nil {
+		return fmt.Errorf("unable to load attached leaves: %w", err)
+	}
+	seen := make(map[LeafLinkOf[K]]bool, len(existing)+len(links))
+	for _, l := range existing {
+		seen[l] = true
+	}
+	var rows []map[string]any
+	for _, l := range links {
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		rows = append(rows, map[string]any{join.leafCol: l.LeafID, join.nodeCol: l.NodeID})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := tx.Table(join.joinTbl).Create(rows).Error; err != nil {
+		return fmt.Errorf("unable to attach leaves: %w", err)
+	}
+	return nil
+}
+
+// uniqueIDs returns ids without duplicates, keeping the first occurrence order.
+func uniqueIDs[T comparable](ids []T) []T {
+	seen := make(map[T]bool, len(ids))
+	out := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
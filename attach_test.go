@@ -0,0 +1,148 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gorm.io/gorm"
+)
+
+// leafNodeIDs returns the node IDs leafID is attached to in the test_leaf_nodes join table.
+func leafNodeIDs(t *testing.T, gdb *gorm.DB, leafID uint) []uint {
+	t.Helper()
+	var ids []uint
+	err := gdb.Table("test_leaf_nodes").Where("test_leaf_leaf_id = ?", leafID).
+		Order("test_payload_node_id").Pluck("test_payload_node_id", &ids).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestAttachLeaves(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			setup := func(t *testing.T) (*closuretree.Tree, *gorm.DB, *TestLeaf) {
+				t.Helper()
+				gdb := connAndClose(t, db)
+				gdb.Exec("DROP TABLE IF EXISTS test_leaf_nodes")
+				gdb.Exec("DROP TABLE IF EXISTS test_leafs")
+				dropTreeTables(gdb, TestPayload{})
+				ct, err := closuretree.New(gdb, TestPayload{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				populateTree(t, ct)
+				if err := gdb.AutoMigrate(&TestLeaf{}); err != nil {
+					t.Fatal(err)
+				}
+				leaf := &TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "leaf"}
+				if err := gdb.Create(leaf).Error; err != nil {
+					t.Fatal(err)
+				}
+				return ct, gdb, leaf
+			}
+			ctx := context.Background()
+
+			t.Run("attach and detach", func(t *testing.T) {
+				ct, gdb, leaf := setup(t)
+				if err := ct.AttachLeaf(ctx, TestLeaf{}, leaf.Id(), 2, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				links := []closuretree.LeafLink{{LeafID: leaf.Id(), NodeID: 2}, {LeafID: leaf.Id(), NodeID: 4}}
+				if err := ct.AttachLeaves(ctx, &TestLeaf{}, links, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(leafNodeIDs(t, gdb, leaf.Id()), []uint{2, 4}); diff != "" {
+					t.Errorf("unexpected nodes after attach (-got +want):\n%s", diff)
+				}
+
+				if err := ct.DetachLeaf(ctx, TestLeaf{}, leaf.Id(), 2, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(leafNodeIDs(t, gdb, leaf.Id()), []uint{4}); diff != "" {
+					t.Errorf("unexpected nodes after detach (-got +want):\n%s", diff)
+				}
+			})
+
+			t.Run("set leaf nodes", func(t *testing.T) {
+				ct, gdb, leaf := setup(t)
+				if err := ct.SetLeafNodes(ctx, TestLeaf{}, leaf.Id(), []uint{1, 2}, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if err := ct.SetLeafNodes(ctx, TestLeaf{}, leaf.Id(), []uint{2, 5}, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(leafNodeIDs(t, gdb, leaf.Id()), []uint{2, 5}); diff != "" {
+					t.Errorf("unexpected nodes (-got +want):\n%s", diff)
+				}
+				if err := ct.SetLeafNodes(ctx, TestLeaf{}, leaf.Id(), nil, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if got := leafNodeIDs(t, gdb, leaf.Id()); len(got) != 0 {
+					t.Errorf("expected the leaf to be detached from all nodes, got %v", got)
+				}
+			})
+
+			t.Run("rejects invalid links", func(t *testing.T) {
+				ct, gdb, leaf := setup(t)
+				other := &TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant2}, Name: "other"}
+				if err := gdb.Create(other).Error; err != nil {
+					t.Fatal(err)
+				}
+				tcs := []struct {
+					name    string
+					link    closuretree.LeafLink
+					wantErr error
+				}{
+					{name: "unknown leaf", link: closuretree.LeafLink{LeafID: 999, NodeID: 2}, wantErr: closuretree.ErrLeafNotFound},
+					{name: "leaf of other tenant", link: closuretree.LeafLink{LeafID: other.Id(), NodeID: 2}, wantErr: closuretree.ErrLeafNotFound},
+					{name: "unknown node", link: closuretree.LeafLink{LeafID: leaf.Id(), NodeID: 999}, wantErr: closuretree.ErrNodeNotFound},
+					{name: "node of other tenant", link: closuretree.LeafLink{LeafID: leaf.Id(), NodeID: 7}, wantErr: closuretree.ErrNodeNotFound},
+				}
+				for _, tc := range tcs {
+					t.Run(tc.name, func(t *testing.T) {
+						links := []closuretree.LeafLink{{LeafID: leaf.Id(), NodeID: 1}, tc.link}
+						err := ct.AttachLeaves(ctx, TestLeaf{}, links, tenant1)
+						if !errors.Is(err, tc.wantErr) {
+							t.Errorf("expected %v, got %v", tc.wantErr, err)
+						}
+						if got := leafNodeIDs(t, gdb, leaf.Id()); len(got) != 0 {
+							t.Errorf("expected the bulk attach to be rolled back, got %v", got)
+						}
+						err = ct.SetLeafNodes(ctx, TestLeaf{}, tc.link.LeafID, []uint{tc.link.NodeID}, tenant1)
+						if !errors.Is(err, tc.wantErr) {
+							t.Errorf("SetLeafNodes: expected %v, got %v", tc.wantErr, err)
+						}
+					})
+				}
+
+				err := ct.AttachLeaf(ctx, TestPayload{}, leaf.Id(), 1, tenant1)
+				if !errors.Is(err, closuretree.ErrItemIsNotTreeLeaf) {
+					t.Errorf("expected ErrItemIsNotTreeLeaf, got %v", err)
+				}
+			})
+
+			t.Run("bulk set", func(t *testing.T) {
+				ct, gdb, leaf := setup(t)
+				second := &TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "second"}
+				if err := gdb.Create(second).Error; err != nil {
+					t.Fatal(err)
+				}
+				err := ct.SetLeavesNodes(ctx, TestLeaf{}, map[uint][]uint{leaf.Id(): {3}, second.Id(): {5, 6}}, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := append(leafNodeIDs(t, gdb, leaf.Id()), leafNodeIDs(t, gdb, second.Id())...)
+				if diff := cmp.Diff(got, []uint{3, 5, 6}, cmpopts.SortSlices(func(a, b uint) bool { return a < b })); diff != "" {
+					t.Errorf("unexpected nodes (-got +want):\n%s", diff)
+				}
+			})
+		})
+	}
+}
@@ -15,16 +15,15 @@ import (
 	"gorm.io/gorm"
 )
 
-var validTableName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+var validTableName = regexp.MustCompile(`^([a-z][a-z0-9_]*\.)?[a-z][a-z0-9_]*$`)
 
 func validateTableName(name string) error {
 	if !validTableName.MatchString(name) {
-		return fmt.Errorf("invalid table name %q: must match [a-z][a-z0-9_]*", name)
+		return fmt.Errorf("invalid table name %q: must match [a-z][a-z0-9_]*, optionally qualified with a schema", name)
 	}
 	return nil
 }
 
-const closureTblName = "closure_tree_rel"
 const ancestorIDMapKey = "ancestorId"
 
 var (
@@ -38,24 +37,94 @@ var (
 	ErrAfterNodeIsSelf        = errors.New("afterNodeID cannot be the node itself")
 )
 
-// Tree represents the access to the closure tree allowing to CRUD nodes on the tree of items
-type Tree struct {
+// TreeOf represents the access to the closure tree allowing to CRUD nodes on the tree of items,
+// whose node IDs are of type K.
+type TreeOf[K ID] struct {
 	db *gorm.DB
 	// table names, allows multiple trees
 	nodesTbl     string
 	relationsTbl string
 	metaTbl      string
+	eventsTbl    string
+	historyTbl   string
+	schemaTbl    string
 	col2FieldMap map[string]string
+	itemType     reflect.Type
+	opts         Options
+	listeners    []any
+	leaves       []leafJoin
+}
+
+// Tree is the closure tree of items embedding Node, with uint IDs.
+type Tree = TreeOf[uint]
+
+// Options holds the optional, tree-level settings that can be passed to NewWithOptions.
+// The zero value is a valid configuration and matches the behaviour of New.
+type Options struct {
+	// UniqueSiblingColumn is the database column name of a payload field, e.g. "name",
+	// whose value must be unique among the direct children of a parent within a tenant.
+	// Write operations that would create a duplicate return ErrDuplicateSibling.
+	// Empty disables the check.
+	UniqueSiblingColumn string
+	// MaxDepth caps the number of levels in the tree, nodes added at the root are on level 1.
+	// Adding or moving a node (including its whole subtree) beyond it returns ErrMaxDepthExceeded.
+	// 0 disables the check.
+	MaxDepth int
+	// MaxChildren caps the number of direct children of any parent, including the root.
+	// Adding or moving a node into a full parent returns ErrMaxChildrenExceeded.
+	// 0 disables the check.
+	//
+	// With UniqueSiblingColumn or MaxChildren set, writes under the same parent are serialized
+	// with a row lock, so concurrent transactions cannot both pass the check. When composing with
+	// an outer transaction on MySQL, use READ COMMITTED or call the tree before other reads.
+	MaxChildren int
+	// Events enables the change-event outbox: every write appends ChangeEvent rows in the same
+	// transaction, to be consumed with ReadEvents and AckEvents. Writes are serialized while
+	// appending, so that events are committed in sequence order.
+	Events bool
+	// History enables the audit history: every write stores HistoryEntry rows with payload
+	// snapshots and the actor set with WithActor, to be queried with History.
+	History bool
+	// LeafDeletePolicy defines what DeleteRecurse does with the join rows of the leaf models
+	// registered with RegisterLeaves that point at deleted nodes. Defaults to LeafDeleteKeep.
+	LeafDeletePolicy LeafDeletePolicy
+	// SkipMigrate disables the schema migration done by NewWithOptions, for databases where the
+	// tables are managed out of band, e.g. with the statements of DDL. Use CheckSchema to verify
+	// the tables at startup.
+	SkipMigrate bool
+	// TableNaming names the closure, meta, events, history and schema tables of the tree, e.g. to
+	// add a prefix or a schema. Defaults to DefaultTableName. Changing it for an existing tree
+	// does not rename the tables.
+	TableNaming TableNaming
+	// StoreParentID stores the parent of every node in a parent_id column of the node table,
+	// maintained by every write, so reads and other tools do not need the closure table to find
+	// the parent. The column is added and filled by Migrate.
+	StoreParentID bool
 }
 
 // New returns a Tree for the given item on the specific gorm Database
 func New(db *gorm.DB, item any) (*Tree, error) {
-	ct, err := newTree(db, item)
+	return NewWithOptions(db, item, Options{})
+}
+
+// NewWithOptions returns a Tree for the given item on the specific gorm Database configured with opts
+func NewWithOptions(db *gorm.DB, item any, opts Options) (*Tree, error) {
+	return NewOf[uint](db, item, opts)
+}
+
+// NewOf returns a tree with node IDs of type K for the given item on the specific gorm Database
+// configured with opts. The item has to embed the node struct of K: Node for uint, Node64 for
+// uint64, NodeUUID or NodeString for string. The closure, meta, events and history tables use
+// the same key type.
+func NewOf[K ID](db *gorm.DB, item any, opts Options) (*TreeOf[K], error) {
+	ct, err := newTree[K](db, item, opts)
 	if err != nil {
 		return nil, err
 	}
-	if err := ct.migrate(item); err != nil {
-		return nil, err
+	if !opts.SkipMigrate {
+		if err := ct.Migrate(context.Background()); err != nil {
+			return nil, err
+		}
 	}
 	if isMySQLDialect(db) {
 		if err := checkMySQLVersion(db); err != nil {
@@ -65,9 +134,29 @@ func New(db *gorm.DB, item any) (*Tree, error) {
 	return ct, nil
 }
 
+// WithTx returns a copy of the Tree that runs every operation on tx, so tree operations can be
+// composed with other writes into one atomic unit. Operations that need their own transaction
+// run in a savepoint of tx and roll back with it.
+func (ct *TreeOf[K]) WithTx(tx *gorm.DB) *TreeOf[K] {
+	txTree := *ct
+	txTree.db = tx
+	return &txTree
+}
+
+// RunInTx runs fn in a single transaction, passing a Tree bound to it. Any error returned by fn
+// rolls back all the writes done through that Tree and the transaction.
+func (ct *TreeOf[K]) RunInTx(ctx context.Context, fn func(t *TreeOf[K]) error) error {
+	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(ct.WithTx(tx))
+	})
+}
+
 // newTree parses the schema and validates the item but does not run migrations.
-func newTree(db *gorm.DB, item any) (*Tree, error) {
-	if !hasNode(item) {
+func newTree[K ID](db *gorm.DB, item any, opts Options) (*TreeOf[K], error) {
+	if !hasNode[K](item) {
+		if hasNodeOfAnyID(item) {
+			return nil, fmt.Errorf("%w with %s IDs", ErrItemIsNotTreeNode, reflect.TypeFor[K]())
+		}
 		return nil, ErrItemIsNotTreeNode
 	}
 
@@ -77,16 +166,11 @@ func newTree(db *gorm.DB, item any) (*Tree, error) {
 		return nil, fmt.Errorf("error parsing schema: %w", err)
 	}
 	name := stmt.Schema.Table
-	relTbl := strings.ToLower(fmt.Sprintf("%s_%s", closureTblName, name))
-	metaTbl := strings.ToLower(fmt.Sprintf("closure_tree_meta_%s", name))
-
 	if err := validateTableName(name); err != nil {
 		return nil, err
 	}
-	if err := validateTableName(relTbl); err != nil {
-		return nil, err
-	}
-	if err := validateTableName(metaTbl); err != nil {
+	tables, err := tableNames(opts.TableNaming, name)
+	if err != nil {
 		return nil, err
 	}
 
@@ -97,36 +181,29 @@ func newTree(db *gorm.DB, item any) (*Tree, error) {
 	}
 	columnFieldMap["ancestor_id"] = ancestorIDMapKey
 
-	ct := &Tree{
+	if err := validateOptions(stmt, opts); err != nil {
+		return nil, err
+	}
+
+	ct := &TreeOf[K]{
 		db:           db,
 		nodesTbl:     name,
 		col2FieldMap: columnFieldMap,
-		relationsTbl: relTbl,
-		metaTbl:      metaTbl,
+		itemType:     stmt.Schema.ModelType,
+		relationsTbl: tables[TableClosure],
+		metaTbl:      tables[TableMeta],
+		eventsTbl:    tables[TableEvents],
+		historyTbl:   tables[TableHistory],
+		schemaTbl:    tables[TableSchema],
+		opts:         opts,
 	}
 
 	return ct, nil
 }
 
-func (ct *Tree) migrate(item any) error {
-	err := ct.db.AutoMigrate(item)
-	if err != nil {
-		return fmt.Errorf("unable to migrate node table: %w", err)
-	}
-	err = ct.db.Table(ct.relationsTbl).AutoMigrate(closureTree{})
-	if err != nil {
-		return fmt.Errorf("unable to migrate closure table: %w", err)
-	}
-	err = ct.db.Table(ct.metaTbl).AutoMigrate(closureTreeMeta{})
-	if err != nil {
-		return fmt.Errorf("unable to migrate meta table: %w", err)
-	}
-	return nil
-}
-
 // validateAfterNode checks that afterNodeID is a direct child of parentID in the closure table.
 // Returns ErrInvalidAfterNode if not found.
-func (ct *Tree) validateAfterNode(tx *gorm.DB, parentID, afterNodeID uint, tenant string) error {
+func (ct *TreeOf[K]) validateAfterNode(tx *gorm.DB, parentID, afterNodeID K, tenant string) error {
 	var count int64
 	err := tx.Table(ct.relationsTbl).
 		Where("ancestor_id = ? AND descendant_id = ? AND depth = 1 AND tenant = ?", parentID, afterNodeID, tenant).
@@ -143,8 +220,8 @@ func (ct *Tree) validateAfterNode(tx *gorm.DB, parentID, afterNodeID uint, tenan
 // computeSortOrder computes the sort_order for a new node to be placed after afterNodeID
 // among siblings of parentID. afterNodeID=0 means place first.
 // Must be called inside a transaction.
-func (ct *Tree) computeSortOrder(tx *gorm.DB, parentID, afterNodeID uint, tenant string) (float64, int, error) {
-	if afterNodeID == 0 {
+func (ct *TreeOf[K]) computeSortOrder(tx *gorm.DB, parentID, afterNodeID K, tenant string) (float64, int, error) {
+	if isRoot(afterNodeID) {
 		// Place first: find minimum sort_order among siblings
 		var minOrder *float64
 		row := tx.Raw(
@@ -229,30 +306,31 @@ func checkMySQLVersion(db *gorm.DB) error {
 
 // GetNodeTableName returns the table name of the stored Nodes, used if you need to interact directly
 // with the database
-func (ct *Tree) GetNodeTableName() string {
+func (ct *TreeOf[K]) GetNodeTableName() string {
 	return ct.nodesTbl
 }
 
 // GetClosureTableName returns the table name of the node closure tree relationship, used if you need to interact directly
 // with the database
-func (ct *Tree) GetClosureTableName() string {
+func (ct *TreeOf[K]) GetClosureTableName() string {
 	return ct.relationsTbl
 }
 
 // closureTreeMeta stores per-(tenant,parent) sort-order health metadata.
-type closureTreeMeta struct {
+type closureTreeMeta[K ID] struct {
 	Tenant      string `gorm:"not null;primaryKey"`
-	ParentID    uint   `gorm:"not null;primaryKey;column:parent_id"`
+	ParentID    K      `gorm:"not null;primaryKey;column:parent_id"`
 	MinHalvings int    `gorm:"not null;default:9999"`
 }
 
 // represents the table that store the relationships
-// Note: if upgrading from a previous version, manually run: DROP INDEX idx_desc_ten
-type closureTree struct {
-	AncestorID   uint   `gorm:"not null;index:idx_anc_ten_dep,composite:1;uniqueIndex:idx_closure_uniq,composite:a"`
-	DescendantID uint   `gorm:"not null;index:idx_desc_ten_dep,composite:1;uniqueIndex:idx_closure_uniq,composite:b"`
-	Tenant       string `gorm:"not null;index:idx_anc_ten_dep,composite:2;index:idx_desc_ten_dep,composite:2;uniqueIndex:idx_closure_uniq,composite:c"`
-	Depth        int    `gorm:"not null;default:0;check:chk_depth,depth >= 0;index:idx_anc_ten_dep,composite:3;index:idx_desc_ten_dep,composite:3;uniqueIndex:idx_closure_uniq,composite:d"`
+// Note: changes to this table must be added as a step in migrationSteps
+// Index and check names are derived from the table name, e.g. idx_<table>_anc_ten_dep.
+type closureTree[K ID] struct {
+	AncestorID   K      `gorm:"not null;index:,composite:anc_ten_dep;uniqueIndex:,composite:closure_uniq"`
+	DescendantID K      `gorm:"not null;index:,composite:desc_ten_dep;uniqueIndex:,composite:closure_uniq"`
+	Tenant       string `gorm:"not null;index:,composite:anc_ten_dep;index:,composite:desc_ten_dep;uniqueIndex:,composite:closure_uniq"`
+	Depth        int    `gorm:"not null;default:0;check:,depth >= 0;index:,composite:anc_ten_dep;index:,composite:desc_ten_dep;uniqueIndex:,composite:closure_uniq"`
 }
 
 // DefaultTenant is used in the database as a stub if not tenant was passed
@@ -269,11 +347,12 @@ func validateTenant(in string) (string, error) {
 }
 
 // Add will add a new entry into the node Database under a specific parent and owned to a specific tenant
-// Note: the passed item has to embed a Node struct, but any value added to the Node will be ignored
+// Note: the passed item has to embed a Node struct, but any value added to the Node will be ignored,
+// except the NodeId of string keys
 //
 //nolint:gocyclo // excluding from linter since implementation was done before we enabled the linter
-func (ct *Tree) Add(ctx context.Context, item any, parentID uint, afterNodeID uint, tenant string) error {
-	if !hasNode(item) {
+func (ct *TreeOf[K]) Add(ctx context.Context, item any, parentID K, afterNodeID K, tenant string) error {
+	if !hasNode[K](item) {
 		return ErrItemIsNotTreeNode
 	}
 	var err error
@@ -296,26 +375,36 @@ func (ct *Tree) Add(ctx context.Context, item any, parentID uint, afterNodeID ui
 	}
 
 	err = ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ct.lockSiblingsInTx(tx, parentID, tenant); err != nil {
+			return err
+		}
 		// Check if the parent node exists and the tenant is the same (inside tx to avoid TOCTOU)
-		if parentID != 0 {
-			var parent Node
+		if !isRoot(parentID) {
+			var count int64
 			err := tx.Table(ct.nodesTbl).
 				Where("node_id = ? AND tenant = ?", parentID, tenant).
-				First(&parent).Error
+				Count(&count).Error
 			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					return ErrParentNotFound
-				}
 				return fmt.Errorf("unable to check parent node: %w", err)
 			}
+			if count == 0 {
+				return ErrParentNotFound
+			}
 		}
 
 		// Validate afterNodeID is a sibling of parentID (if non-zero)
-		if afterNodeID != 0 {
+		if !isRoot(afterNodeID) {
 			if err := ct.validateAfterNode(tx, parentID, afterNodeID, tenant); err != nil {
 				return err
 			}
 		}
+
+		hooks := ct.hookTargets(reflectItem)
+		event := HookEventOf[K]{Tx: tx, Tenant: tenant, Item: reflectItem, NewParentID: parentID, AfterNodeID: afterNodeID}
+		if err := callHooks(hooks, "BeforeAdd", func(h BeforeAddHookOf[K]) error { return h.BeforeAdd(ctx, event) }); err != nil {
+			return err
+		}
+
 		// Compute the sort order for the new node
 		sortOrder, halvings, err := ct.computeSortOrder(tx, parentID, afterNodeID, tenant)
 		if err != nil {
@@ -328,7 +417,9 @@ func (ct *Tree) Add(ctx context.Context, item any, parentID uint, afterNodeID ui
 		// Set Node fields (including SortOrder) on the item before Create
 		v := reflect.ValueOf(reflectItem).Elem()
 		if nodeField, ok := findNodeValue(t, v); ok && nodeField.CanSet() {
-			nodeField.Set(reflect.ValueOf(Node{NodeId: 0, Tenant: tenant, SortOrder: sortOrder}))
+			if err := initNode(nodeField, tenant, sortOrder); err != nil {
+				return err
+			}
 		}
 
 		// create the Node item
@@ -337,33 +428,30 @@ func (ct *Tree) Add(ctx context.Context, item any, parentID uint, afterNodeID ui
 			return fmt.Errorf("unable to add node: %w", err)
 		}
 
-		id, gotTennant, err := getNodeData(reflectItem)
+		id, gotTennant, err := getNodeData[K](reflectItem)
 		if err != nil {
 			return fmt.Errorf("unable to get Item ID: %w", err)
 		}
 
-		// Add reflexive relationship
-		err = tx.Table(ct.relationsTbl).Create(&closureTree{AncestorID: id, DescendantID: id, Tenant: gotTennant, Depth: 0}).Error
+		if err := ct.insertRelsInTx(tx, id, parentID, gotTennant); err != nil {
+			return err
+		}
+		if err := ct.enforceConstraints(tx, id, gotTennant, true); err != nil {
+			return err
+		}
+		after, err := ct.snapshotPayloads(tx, gotTennant, id)
 		if err != nil {
 			return err
 		}
-
-		if parentID == 0 {
-			// Create a root note relationship
-			sqlstr := fmt.Sprintf(addRootRelQuery, ct.relationsTbl)
-			ex := tx.Exec(sqlstr, id, gotTennant)
-			if ex.Error != nil {
-				return ex.Error
-			}
-		} else {
-			// Copy all ancestors of the parent to include the new tag
-			sqlstr := fmt.Sprintf(addRelsQuery, ct.relationsTbl, ct.relationsTbl)
-			ex := tx.Exec(sqlstr, id, gotTennant, parentID, gotTennant)
-			if ex.Error != nil {
-				return ex.Error
-			}
+		err = ct.recordChanges(ctx, tx, []ChangeEventOf[K]{{
+			Op: EventAdd, Tenant: gotTennant, NodeID: id, NewParentID: ptr(parentID), NewPosition: ptr(sortOrder),
+		}}, payloadSnapshots[K]{after: after})
+		if err != nil {
+			return err
 		}
-		return nil
+
+		event.NodeID = id
+		return callHooks(hooks, "AfterAdd", func(h AfterAddHookOf[K]) error { return h.AfterAdd(ctx, event) })
 	})
 
 	if err != nil {
@@ -387,12 +475,35 @@ func (ct *Tree) Add(ctx context.Context, item any, parentID uint, afterNodeID ui
 	return nil
 }
 
+// insertRelsInTx adds the closure rows of the newly created node id below parentID.
+func (ct *TreeOf[K]) insertRelsInTx(tx *gorm.DB, id, parentID K, tenant string) error {
+	// Add reflexive relationship
+	err := tx.Table(ct.relationsTbl).Create(&closureTree[K]{AncestorID: id, DescendantID: id, Tenant: tenant, Depth: 0}).Error
+	if err != nil {
+		return err
+	}
+
+	if isRoot(parentID) {
+		// Create a root note relationship
+		sqlstr := fmt.Sprintf(addRootRelQuery, ct.relationsTbl)
+		err = tx.Exec(sqlstr, parentID, id, tenant).Error
+	} else {
+		// Copy all ancestors of the parent to include the new tag
+		sqlstr := fmt.Sprintf(addRelsQuery, ct.relationsTbl, ct.relationsTbl)
+		err = tx.Exec(sqlstr, id, tenant, parentID, tenant).Error
+	}
+	if err != nil {
+		return err
+	}
+	return ct.setParentIDInTx(tx, id, parentID, tenant)
+}
+
 const addRelsQuery = `INSERT INTO %s (ancestor_id, descendant_id, tenant, depth)
 			SELECT ancestor_id, ?, ?, depth + 1
 			FROM %s
 			WHERE descendant_id = ? AND tenant = ?;`
 
-const addRootRelQuery = `INSERT INTO %s (ancestor_id, descendant_id, tenant, depth) VALUES (0, ?, ?, 1);`
+const addRootRelQuery = `INSERT INTO %s (ancestor_id, descendant_id, tenant, depth) VALUES (?, ?, ?, 1);`
 
 // Update modifies a node's fields and/or moves it to a new parent, and/or reorders it, atomically.
 //
@@ -400,19 +511,20 @@ const addRootRelQuery = `INSERT INTO %s (ancestor_id, descendant_id, tenant, dep
 // Pass a non-nil newParentID to move the node: &0 moves to root, &someID moves under someID.
 // Pass a non-nil afterNodeID to set sort order: &0 places first, &someID places after that sibling.
 // Passing all three nil returns ErrNoOp.
-func (ct *Tree) Update(ctx context.Context, id uint, item any, newParentID *uint, afterNodeID *uint, tenant string) error {
+// Field updates and moves are checked against the tree constraints configured in Options.
+func (ct *TreeOf[K]) Update(ctx context.Context, id K, item any, newParentID *K, afterNodeID *K, tenant string) error {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
 		return err
 	}
-	if id == 0 {
+	if isRoot(id) {
 		return ErrNodeNotFound
 	}
 	if item == nil && newParentID == nil && afterNodeID == nil {
 		return ErrNoOp
 	}
-	if item != nil && !hasNode(item) {
+	if item != nil && !hasNode[K](item) {
 		return ErrItemIsNotTreeNode
 	}
 
@@ -425,43 +537,163 @@ func (ct *Tree) Update(ctx context.Context, id uint, item any, newParentID *uint
 	}
 
 	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if item != nil {
-			res := tx.Table(ct.nodesTbl).Where("node_id = ? AND tenant = ?", id, tenant).Updates(updateMap)
-			if res.Error != nil {
-				return fmt.Errorf("unable to update node: %w", res.Error)
-			}
-			if res.RowsAffected == 0 {
-				return ErrNodeNotFound
-			}
+		return ct.updateInTx(ctx, tx, id, item, updateMap, newParentID, afterNodeID, tenant)
+	})
+}
+
+// updateInTx runs the field update, move and reorder of Update within tx, calling the
+// move and reorder hooks around them.
+func (ct *TreeOf[K]) updateInTx(ctx context.Context, tx *gorm.DB, id K, item any, updateMap map[string]any,
+	newParentID, afterNodeID *K, tenant string) error {
+	if err := ct.lockUpdateInTx(tx, id, item != nil, newParentID, tenant); err != nil {
+		return err
+	}
+	var snaps payloadSnapshots[K]
+	if item != nil {
+		var err error
+		if snaps, err = ct.updateFieldsInTx(tx, id, updateMap, tenant); err != nil {
+			return err
 		}
-		if newParentID != nil {
-			if err := ct.maybeMoveInTx(tx, id, *newParentID, afterNodeID != nil, tenant); err != nil {
+	}
+
+	hooks := ct.hookTargets(item)
+	event, oldPos, err := ct.updateHookEvent(tx, id, item, newParentID, afterNodeID, tenant)
+	if err != nil {
+		return err
+	}
+	moved := newParentID != nil && *newParentID != event.OldParentID
+	if newParentID != nil {
+		if moved {
+			if err := callHooks(hooks, "BeforeMove", func(h BeforeMoveHookOf[K]) error { return h.BeforeMove(ctx, event) }); err != nil {
 				return err
 			}
 		}
-		if afterNodeID != nil {
-			if err := ct.reorderInTx(tx, id, *afterNodeID, newParentID, tenant); err != nil {
-				return err
-			}
+		if err := ct.maybeMoveInTx(tx, id, *newParentID, afterNodeID != nil, tenant); err != nil {
+			return err
+		}
+	}
+	if afterNodeID != nil {
+		if err := ct.reorderInTx(tx, id, *afterNodeID, newParentID, tenant); err != nil {
+			return err
 		}
+	}
+	if item != nil || newParentID != nil {
+		if err := ct.enforceConstraints(tx, id, tenant, newParentID != nil); err != nil {
+			return err
+		}
+	}
+	if err := ct.recordUpdate(ctx, tx, event, item != nil, moved, afterNodeID != nil, oldPos, snaps); err != nil {
+		return err
+	}
+	return afterUpdateHooks(ctx, hooks, event, moved, afterNodeID != nil)
+}
+
+// lockUpdateInTx locks the siblings an update can conflict with: those under the new parent
+// of a move, or the current siblings when a field update is checked for unique sibling values.
+func (ct *TreeOf[K]) lockUpdateInTx(tx *gorm.DB, id K, fields bool, newParentID *K, tenant string) error {
+	if newParentID != nil {
+		return ct.lockSiblingsInTx(tx, *newParentID, tenant)
+	}
+	if fields && ct.opts.UniqueSiblingColumn != "" {
+		return ct.lockSiblingsOfInTx(tx, id, tenant)
+	}
+	return nil
+}
+
+// updateFieldsInTx writes updateMap to node id and returns the payload snapshots around it.
+func (ct *TreeOf[K]) updateFieldsInTx(tx *gorm.DB, id K, updateMap map[string]any, tenant string) (payloadSnapshots[K], error) {
+	var snaps payloadSnapshots[K]
+	var err error
+	if snaps.before, err = ct.snapshotPayloads(tx, tenant, id); err != nil {
+		return snaps, err
+	}
+	res := tx.Table(ct.nodesTbl).Where("node_id = ? AND tenant = ?", id, tenant).Updates(updateMap)
+	if res.Error != nil {
+		return snaps, fmt.Errorf("unable to update node: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return snaps, ErrNodeNotFound
+	}
+	if snaps.after, err = ct.snapshotPayloads(tx, tenant, id); err != nil {
+		return snaps, err
+	}
+	return snaps, nil
+}
+
+// updateHookEvent builds the hook event of an update. For moves and reorders it loads the
+// current parent and sort order of the node, the latter is returned for the change events.
+func (ct *TreeOf[K]) updateHookEvent(tx *gorm.DB, id K, item any, newParentID, afterNodeID *K,
+	tenant string) (HookEventOf[K], float64, error) {
+	event := HookEventOf[K]{Tx: tx, Tenant: tenant, NodeID: id, Item: item}
+	if newParentID == nil && afterNodeID == nil {
+		return event, 0, nil
+	}
+	oldParentID, err := ct.parentIDInTx(tx, id, tenant)
+	if err != nil {
+		return event, 0, err
+	}
+	event.OldParentID = oldParentID
+	event.NewParentID = oldParentID
+	if newParentID != nil {
+		event.NewParentID = *newParentID
+	}
+	if afterNodeID != nil {
+		event.AfterNodeID = *afterNodeID
+	}
+	oldPos, err := ct.sortOrderInTx(tx, id, tenant)
+	return event, oldPos, err
+}
+
+// recordUpdate appends the change events and history entries of an update when they are enabled.
+func (ct *TreeOf[K]) recordUpdate(ctx context.Context, tx *gorm.DB, event HookEventOf[K], fields, moved, reordered bool,
+	oldPos float64, snaps payloadSnapshots[K]) error {
+	if !ct.tracksChanges() {
 		return nil
-	})
+	}
+	events, err := ct.updateEvents(tx, event, fields, moved, reordered, oldPos)
+	if err != nil {
+		return err
+	}
+	return ct.recordChanges(ctx, tx, events, snaps)
+}
+
+// afterUpdateHooks calls the AfterMove and AfterReorder hooks of an update.
+func afterUpdateHooks[K ID](ctx context.Context, hooks []any, event HookEventOf[K], moved, reordered bool) error {
+	if moved {
+		if err := callHooks(hooks, "AfterMove", func(h AfterMoveHookOf[K]) error { return h.AfterMove(ctx, event) }); err != nil {
+			return err
+		}
+	}
+	if reordered {
+		return callHooks(hooks, "AfterReorder", func(h AfterReorderHookOf[K]) error { return h.AfterReorder(ctx, event) })
+	}
+	return nil
+}
+
+// parentIDInTx returns the direct parent of node id, 0 for root nodes or unknown ids.
+func (ct *TreeOf[K]) parentIDInTx(tx *gorm.DB, id K, tenant string) (K, error) {
+	var row struct{ AncestorID K }
+	err := tx.Raw(
+		fmt.Sprintf(`SELECT ancestor_id FROM %s WHERE descendant_id = ? AND depth = 1 AND tenant = ? LIMIT 1`,
+			ct.relationsTbl),
+		id, tenant,
+	).Scan(&row).Error
+	if err != nil {
+		return row.AncestorID, err
+	}
+	return row.AncestorID, nil
 }
 
 // maybeMoveInTx moves node id to newPID unless hasReorder is true and the node is
 // already under newPID (same-parent reorder). Without this guard, moveInTx would return
 // ErrInvalidMove for a same-parent reorder before the reorder gets to run.
-func (ct *Tree) maybeMoveInTx(tx *gorm.DB, id, newPID uint, hasReorder bool, tenant string) error {
+func (ct *TreeOf[K]) maybeMoveInTx(tx *gorm.DB, id, newPID K, hasReorder bool, tenant string) error {
 	if hasReorder {
-		var row struct{ AncestorID uint }
-		if err := tx.Raw(
-			fmt.Sprintf(`SELECT ancestor_id FROM %s WHERE descendant_id = ? AND depth = 1 AND tenant = ? LIMIT 1`,
-				ct.relationsTbl),
-			id, tenant,
-		).Scan(&row).Error; err != nil {
+		currentParentID, err := ct.parentIDInTx(tx, id, tenant)
+		if err != nil {
 			return err
 		}
-		if row.AncestorID == newPID {
+		if currentParentID == newPID {
 			return nil // already under target parent; let reorder handle the rest
 		}
 	}
@@ -471,32 +703,27 @@ func (ct *Tree) maybeMoveInTx(tx *gorm.DB, id, newPID uint, hasReorder bool, ten
 // reorderInTx updates the sort_order of node id to place it after afterID among
 // siblings of the effective parent. afterID=0 means place first.
 // newParentID is non-nil when the node was just moved; it determines the effective parent.
-func (ct *Tree) reorderInTx(tx *gorm.DB, id, afterID uint, newParentID *uint, tenant string) error {
+func (ct *TreeOf[K]) reorderInTx(tx *gorm.DB, id, afterID K, newParentID *K, tenant string) error {
 	// ErrAfterNodeIsSelf check first
 	if afterID == id {
 		return ErrAfterNodeIsSelf
 	}
 
 	// Resolve effective parent
-	var effectiveParentID uint
+	var effectiveParentID K
 	if newParentID != nil {
 		effectiveParentID = *newParentID
 	} else {
 		// Look up current parent via closure table
-		var row struct{ AncestorID uint }
-		err := tx.Raw(
-			fmt.Sprintf(`SELECT ancestor_id FROM %s WHERE descendant_id = ? AND depth = 1 AND tenant = ? LIMIT 1`,
-				ct.relationsTbl),
-			id, tenant,
-		).Scan(&row).Error
+		currentParentID, err := ct.parentIDInTx(tx, id, tenant)
 		if err != nil {
 			return err
 		}
-		effectiveParentID = row.AncestorID
+		effectiveParentID = currentParentID
 	}
 
 	// Validate afterID (if non-zero)
-	if afterID != 0 {
+	if !isRoot(afterID) {
 		if err := ct.validateAfterNode(tx, effectiveParentID, afterID, tenant); err != nil {
 			return err
 		}
@@ -521,14 +748,14 @@ func (ct *Tree) reorderInTx(tx *gorm.DB, id, afterID uint, newParentID *uint, te
 // preserving their current relative order (sort_order ASC, node_id ASC).
 // parentID=0 renormalizes root nodes. No-op if there are no children.
 // Runs in a single transaction; rolls back if any update fails.
-func (ct *Tree) Renormalize(ctx context.Context, parentID uint, tenant string) error {
+func (ct *TreeOf[K]) Renormalize(ctx context.Context, parentID K, tenant string) error {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
 		return err
 	}
 	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) (txErr error) {
-		sqlstr := fmt.Sprintf(`SELECT n.node_id FROM %s n
+		sqlstr := fmt.Sprintf(`SELECT n.node_id, n.sort_order FROM %s n
 JOIN %s r ON r.descendant_id = n.node_id AND r.depth = 1 AND r.tenant = n.tenant
 WHERE r.ancestor_id = ? AND n.tenant = ?
 ORDER BY n.sort_order ASC, n.node_id ASC`, ct.nodesTbl, ct.relationsTbl)
@@ -543,26 +770,40 @@ ORDER BY n.sort_order ASC, n.node_id ASC`, ct.nodesTbl, ct.relationsTbl)
 			}
 		}()
 
-		var ids []uint
+		var ids []K
+		var oldOrders []float64
 		for rows.Next() {
-			var id uint
-			if err := rows.Scan(&id); err != nil {
+			var id K
+			var oldOrder float64
+			if err := rows.Scan(&id, &oldOrder); err != nil {
 				return fmt.Errorf("renormalize: failed to scan id: %w", err)
 			}
 			ids = append(ids, id)
+			oldOrders = append(oldOrders, oldOrder)
 		}
 		if err := rows.Err(); err != nil {
 			return err
 		}
 
+		var events []ChangeEventOf[K]
 		for i, id := range ids {
 			sortOrder := float64((i + 1) * 10)
 			if err := tx.Exec(
 				fmt.Sprintf(`UPDATE %s SET sort_order = ? WHERE node_id = ? AND tenant = ?`, ct.nodesTbl),
 				sortOrder, id, tenant,
 			).Error; err != nil {
-				return fmt.Errorf("renormalize: failed to update node %d: %w", id, err)
+				return fmt.Errorf("renormalize: failed to update node %v: %w", id, err)
 			}
+			if oldOrders[i] != sortOrder {
+				events = append(events, ChangeEventOf[K]{
+					Op: EventRenormalize, Tenant: tenant, NodeID: id,
+					OldParentID: ptr(parentID), NewParentID: ptr(parentID),
+					OldPosition: ptr(oldOrders[i]), NewPosition: ptr(sortOrder),
+				})
+			}
+		}
+		if err := ct.recordChanges(ctx, tx, events, payloadSnapshots[K]{}); err != nil {
+			return err
 		}
 		// Reset metadata: delete the row so it is recreated fresh on next insertion.
 		if err := tx.Exec(
@@ -580,14 +821,14 @@ ORDER BY n.sort_order ASC, n.node_id ASC`, ct.nodesTbl, ct.relationsTbl)
 // Use DefaultHalvingsBuffer for the recommended early-warning threshold.
 // Each group is renormalized in its own transaction. On error, returns the number
 // of groups successfully renormalized so far along with the error.
-func (ct *Tree) RenormalizeAll(ctx context.Context, tenant string, halvingsBuffer int) (int, error) {
+func (ct *TreeOf[K]) RenormalizeAll(ctx context.Context, tenant string, halvingsBuffer int) (int, error) {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
 		return 0, err
 	}
 
-	var parentIDs []uint
+	var parentIDs []K
 	err = ct.db.WithContext(ctx).Table(ct.metaTbl).
 		Where("tenant = ? AND min_halvings <= ?", tenant, halvingsBuffer).
 		Pluck("parent_id", &parentIDs).Error
@@ -597,7 +838,7 @@ func (ct *Tree) RenormalizeAll(ctx context.Context, tenant string, halvingsBuffe
 
 	for i, parentID := range parentIDs {
 		if err := ct.Renormalize(ctx, parentID, tenant); err != nil {
-			return i, fmt.Errorf("RenormalizeAll: failed to renormalize parent %d: %w", parentID, err)
+			return i, fmt.Errorf("RenormalizeAll: failed to renormalize parent %v: %w", parentID, err)
 		}
 	}
 	return len(parentIDs), nil
@@ -612,14 +853,14 @@ const DefaultHalvingsBuffer = 15
 // close to float64 exhaustion. halvingsBuffer=0 fires only when the next insertion
 // would collide; use DefaultHalvingsBuffer (15) for an early warning.
 // Returns false with no error if parentID has no children or no metadata yet.
-func (ct *Tree) NeedsRenormalize(ctx context.Context, parentID uint, tenant string, halvingsBuffer int) (bool, error) {
+func (ct *TreeOf[K]) NeedsRenormalize(ctx context.Context, parentID K, tenant string, halvingsBuffer int) (bool, error) {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
 		return false, err
 	}
 
-	var meta closureTreeMeta
+	var meta closureTreeMeta[K]
 	err = ct.db.WithContext(ctx).Table(ct.metaTbl).
 		Where("tenant = ? AND parent_id = ?", tenant, parentID).
 		First(&meta).Error
@@ -635,7 +876,7 @@ func (ct *Tree) NeedsRenormalize(ctx context.Context, parentID uint, tenant stri
 // NeedsRenormalizeAny reports whether any sibling group under the given tenant has
 // sort_order spacing close to float64 exhaustion. Equivalent to calling NeedsRenormalize
 // for every parent in the tree, but in a single query.
-func (ct *Tree) NeedsRenormalizeAny(ctx context.Context, tenant string, halvingsBuffer int) (bool, error) {
+func (ct *TreeOf[K]) NeedsRenormalizeAny(ctx context.Context, tenant string, halvingsBuffer int) (bool, error) {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
@@ -653,7 +894,7 @@ func (ct *Tree) NeedsRenormalizeAny(ctx context.Context, tenant string, halvings
 }
 
 // buildUpdateMap builds the column→value map for an Update call using reflection.
-func (ct *Tree) buildUpdateMap(item any, id uint, tenant string) (map[string]any, error) {
+func (ct *TreeOf[K]) buildUpdateMap(item any, id K, tenant string) (map[string]any, error) {
 	t := reflect.TypeOf(item)
 	itemIsPointer := false
 	if t.Kind() == reflect.Ptr {
@@ -668,7 +909,9 @@ func (ct *Tree) buildUpdateMap(item any, id uint, tenant string) (map[string]any
 	}
 	v := reflect.ValueOf(reflectItem).Elem()
 	if nodeField, ok := findNodeValue(t, v); ok && nodeField.CanSet() {
-		nodeField.Set(reflect.ValueOf(Node{NodeId: id, Tenant: tenant}))
+		nodeField.Set(reflect.Zero(nodeField.Type()))
+		nodeField.FieldByName(nodeIDField).Set(reflect.ValueOf(id))
+		nodeField.FieldByName(tenantIdField).SetString(tenant)
 	}
 
 	updateStmt := &gorm.Statement{DB: ct.db}
@@ -680,7 +923,7 @@ func (ct *Tree) buildUpdateMap(item any, id uint, tenant string) (map[string]any
 		if f.DBName == "" || !f.Updatable {
 			continue
 		}
-		if f.OwnerSchema != nil && f.OwnerSchema.ModelType == reflect.TypeOf(Node{}) {
+		if f.OwnerSchema != nil && isNodeType(f.OwnerSchema.ModelType) {
 			continue
 		}
 		fieldVal := reflect.ValueOf(reflectItem).Elem().FieldByName(f.Name)
@@ -692,7 +935,7 @@ func (ct *Tree) buildUpdateMap(item any, id uint, tenant string) (map[string]any
 }
 
 // moveInTx performs the closure-table move of node id to parent newPID within tx.
-func (ct *Tree) moveInTx(tx *gorm.DB, id, newPID uint, tenant string) error {
+func (ct *TreeOf[K]) moveInTx(tx *gorm.DB, id, newPID K, tenant string) error {
 	// Same-parent guard (uses tx to avoid TOCTOU)
 	var sameParentCount int64
 	if err := tx.Table(ct.relationsTbl).
@@ -704,7 +947,7 @@ func (ct *Tree) moveInTx(tx *gorm.DB, id, newPID uint, tenant string) error {
 		return ErrInvalidMove
 	}
 
-	if newPID != 0 {
+	if !isRoot(newPID) {
 		// Cycle guard: ensure new parent is not a descendant of id (uses tx)
 		var descCount int64
 		if err := tx.Table(ct.relationsTbl).
@@ -736,26 +979,32 @@ func (ct *Tree) moveInTx(tx *gorm.DB, id, newPID uint, tenant string) error {
 }
 
 // insertNewPathsInTx inserts closure rows connecting the moved subtree to its new ancestors.
-func (ct *Tree) insertNewPathsInTx(tx *gorm.DB, id, newPID uint, tenant string) error {
-	if newPID == 0 {
+func (ct *TreeOf[K]) insertNewPathsInTx(tx *gorm.DB, id, newPID K, tenant string) error {
+	if isRoot(newPID) {
 		insertSql := fmt.Sprintf(moveQueryInsertNewToRoot, ct.relationsTbl, ct.relationsTbl)
-		insExec := tx.Exec(insertSql, id, tenant)
-		if insExec.Error == nil && insExec.RowsAffected == 0 {
+		insExec := tx.Exec(insertSql, newPID, id, tenant)
+		if insExec.Error != nil {
+			return insExec.Error
+		}
+		if insExec.RowsAffected == 0 {
 			return ErrNodeNotFound
 		}
-		return insExec.Error
+		return ct.setParentIDInTx(tx, id, newPID, tenant)
 	}
 	insertSql := fmt.Sprintf(moveQueryInsertNew, ct.relationsTbl, ct.relationsTbl, ct.relationsTbl)
 	insExec := tx.Exec(insertSql, id, newPID, tenant, tenant)
-	if insExec.Error == nil && insExec.RowsAffected == 0 {
+	if insExec.Error != nil {
+		return insExec.Error
+	}
+	if insExec.RowsAffected == 0 {
 		return ErrParentNotFound
 	}
-	return insExec.Error
+	return ct.setParentIDInTx(tx, id, newPID, tenant)
 }
 
 const moveQueryInsertNewToRoot = `
 INSERT INTO  %s (ancestor_id, descendant_id, depth, tenant)
-SELECT 0, c.descendant_id, c.depth + 1, c.tenant
+SELECT ?, c.descendant_id, c.depth + 1, c.tenant
 FROM  %s c
 WHERE c.ancestor_id = ? AND c.tenant = ?;
 `
@@ -782,13 +1031,43 @@ WHERE descendant_id IN (SELECT descendant_id FROM subtree)
 AND ancestor_id NOT IN (SELECT descendant_id FROM subtree)
 AND tenant = ?`
 
-func (ct *Tree) DeleteRecurse(ctx context.Context, nodeId uint, tenant string) error {
+// DeleteRecurse deletes the node nodeId and all its descendants in a single transaction.
+func (ct *TreeOf[K]) DeleteRecurse(ctx context.Context, nodeId K, tenant string) error {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
 		return err
 	}
 	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var deletedIDs []K
+		err := tx.Table(ct.relationsTbl).
+			Where("ancestor_id = ? AND tenant = ?", nodeId, tenant).
+			Order("depth, descendant_id").
+			Pluck("descendant_id", &deletedIDs).Error
+		if err != nil {
+			return fmt.Errorf("deleteRecurse: failed to collect nodes: %w", err)
+		}
+		if len(deletedIDs) == 0 {
+			return ErrNodeNotFound
+		}
+		hooks := ct.hookTargets(nil)
+		event := HookEventOf[K]{Tx: tx, Tenant: tenant, NodeID: nodeId, DeletedIDs: deletedIDs}
+		if err := callHooks(hooks, "BeforeDelete", func(h BeforeDeleteHookOf[K]) error { return h.BeforeDelete(ctx, event) }); err != nil {
+			return err
+		}
+		var events []ChangeEventOf[K]
+		var snaps payloadSnapshots[K]
+		if ct.tracksChanges() {
+			if events, err = ct.deleteEvents(tx, nodeId, tenant); err != nil {
+				return err
+			}
+			if snaps.before, err = ct.snapshotSubtreePayloads(tx, tenant, nodeId); err != nil {
+				return err
+			}
+		}
+		if err := ct.applyLeafDeletePolicy(tx, nodeId, tenant); err != nil {
+			return err
+		}
 
 		// delete the nodes
 		delNodesSql := fmt.Sprintf(deleteNodesRec, ct.nodesTbl, ct.relationsTbl, ct.nodesTbl)
@@ -804,34 +1083,25 @@ func (ct *Tree) DeleteRecurse(ctx context.Context, nodeId uint, tenant string) e
 			return ErrNodeNotFound
 		}
 
+		// Clean up sort-order metadata of the deleted parent groups, including the root node
+		// itself: deleted nodes can no longer have children, so their meta rows are stale.
+		// The subtree is read from the closure table, so this runs before its rows are deleted.
+		delMetaSql := fmt.Sprintf(deleteSubtreeMetaQuery, ct.metaTbl, ct.relationsTbl)
+		if err := tx.Exec(delMetaSql, tenant, nodeId, tenant).Error; err != nil {
+			return fmt.Errorf("deleteRecurse: failed to clean metadata: %w", err)
+		}
+
 		// Delete old closure relationships
 		delRelSql := fmt.Sprintf(deleteRelationsQuery, ct.relationsTbl, ct.relationsTbl)
 		exec2 := tx.Exec(delRelSql, nodeId, tenant, tenant)
 		if exec2.Error != nil {
 			return exec2.Error
 		}
-
-		// Clean up sort-order metadata for any deleted parent groups.
-		// Deleted nodes can no longer have children, so their meta rows are stale.
-		// This includes both deleted descendants and the root node itself.
-		if err := tx.Exec(
-			fmt.Sprintf(`DELETE FROM %s WHERE tenant = ? AND parent_id IN (
-				SELECT descendant_id FROM %s WHERE ancestor_id = ? AND tenant = ?
-			)`, ct.metaTbl, ct.relationsTbl),
-			tenant, nodeId, tenant,
-		).Error; err != nil {
-			return fmt.Errorf("deleteRecurse: failed to clean metadata for descendants: %w", err)
-		}
-
-		// Also delete the meta row for the root node itself, since it no longer exists
-		if err := tx.Exec(
-			fmt.Sprintf(`DELETE FROM %s WHERE tenant = ? AND parent_id = ?`, ct.metaTbl),
-			tenant, nodeId,
-		).Error; err != nil {
-			return fmt.Errorf("deleteRecurse: failed to clean metadata for root: %w", err)
+		if err := ct.recordChanges(ctx, tx, events, snaps); err != nil {
+			return err
 		}
 
-		return nil
+		return callHooks(hooks, "AfterDelete", func(h AfterDeleteHookOf[K]) error { return h.AfterDelete(ctx, event) })
 	})
 }
 
@@ -845,6 +1115,12 @@ DELETE FROM %s
 WHERE node_id IN (SELECT node_id FROM nodes_to_delete)
   AND tenant = ?;`
 
+// deleteSubtreeMetaQuery deletes the meta rows of every node in the subtree of a node, the node
+// included through its self row.
+const deleteSubtreeMetaQuery = `DELETE FROM %s
+WHERE tenant = ?
+  AND parent_id IN (SELECT descendant_id FROM %s WHERE ancestor_id = ? AND tenant = ?);`
+
 const deleteRelationsQuery = `WITH descendants AS (
 	SELECT descendant_id FROM %s WHERE ancestor_id = ? AND tenant = ?
 )
@@ -856,9 +1132,9 @@ WHERE tenant = ?
   );`
 
 // GetNode loads a single item into the passed pointer
-func (ct *Tree) GetNode(ctx context.Context, nodeID uint, tenant string, item any) error {
+func (ct *TreeOf[K]) GetNode(ctx context.Context, nodeID K, tenant string, item any) error {
 
-	if !hasNode(item) {
+	if !hasNode[K](item) {
 		return ErrItemIsNotTreeNode
 	}
 	var err error
@@ -873,6 +1149,9 @@ func (ct *Tree) GetNode(ctx context.Context, nodeID uint, tenant string, item an
 	}
 
 	sqlstr := fmt.Sprintf(getNodeQuery, ct.nodesTbl, ct.relationsTbl)
+	if ct.opts.StoreParentID {
+		sqlstr = fmt.Sprintf(getNodeStoredParentQuery, ct.nodesTbl)
+	}
 	result := ct.db.WithContext(ctx).Raw(sqlstr, nodeID, tenant).Scan(item)
 	if result.Error != nil {
 		return fmt.Errorf("failed to get node: %w", result.Error)
@@ -892,8 +1171,12 @@ LEFT JOIN %s AS parent_rel
 WHERE nodes.node_id = ? AND nodes.tenant = ?
 LIMIT 1`
 
+const getNodeStoredParentQuery = `SELECT nodes.* FROM %s AS nodes
+WHERE nodes.node_id = ? AND nodes.tenant = ?
+LIMIT 1`
+
 // IsDescendant returns true if descendantID is a descendant of ancestorID in the given tenant.
-func (ct *Tree) IsDescendant(ctx context.Context, ancestorID, descendantID uint, tenant string) (bool, error) {
+func (ct *TreeOf[K]) IsDescendant(ctx context.Context, ancestorID, descendantID K, tenant string) (bool, error) {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
@@ -912,7 +1195,7 @@ func (ct *Tree) IsDescendant(ctx context.Context, ancestorID, descendantID uint,
 }
 
 // IsChildOf checks if nodeID already has newParentID as its parent in the closure table.
-func (ct *Tree) IsChildOf(ctx context.Context, nodeID, parentID uint, tenant string) (bool, error) {
+func (ct *TreeOf[K]) IsChildOf(ctx context.Context, nodeID, parentID K, tenant string) (bool, error) {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
@@ -934,7 +1217,7 @@ func (ct *Tree) IsChildOf(ctx context.Context, nodeID, parentID uint, tenant str
 // parent determines the root node id of to load.
 // maxDepth determines the depth of the relationship to load: 0 means all children, 1 only direct children and so on.
 // tenant determines the tenant to be used
-func (ct *Tree) Descendants(ctx context.Context, parent uint, maxDepth int, tenant string, items interface{}) (err error) {
+func (ct *TreeOf[K]) Descendants(ctx context.Context, parent K, maxDepth int, tenant string, items interface{}) (err error) {
 	if items == nil {
 		return errors.New("items cannot be nil")
 	}
@@ -959,6 +1242,9 @@ func (ct *Tree) Descendants(ctx context.Context, parent uint, maxDepth int, tena
 		maxDepth = absMaxDepth
 	}
 	sqlstr := fmt.Sprintf(descendantsQuery, ct.nodesTbl, ct.relationsTbl, ct.relationsTbl)
+	if ct.opts.StoreParentID {
+		sqlstr = fmt.Sprintf(descendantsStoredParentQuery, ct.nodesTbl, ct.relationsTbl)
+	}
 
 	rows, err := ct.db.WithContext(ctx).Raw(sqlstr, parent, maxDepth, tenant).Rows()
 	if err != nil {
@@ -995,14 +1281,20 @@ LEFT JOIN %s AS parent_rel
 WHERE ct.ancestor_id = ? AND ct.depth > 0 AND ct.depth <= ? AND nodes.tenant = ?
 ORDER BY ct.depth, nodes.sort_order ASC, nodes.node_id ASC;`
 
+const descendantsStoredParentQuery = `SELECT nodes.*
+FROM %s AS nodes
+JOIN %s AS ct ON ct.descendant_id = nodes.node_id AND ct.tenant = nodes.tenant
+WHERE ct.ancestor_id = ? AND ct.depth > 0 AND ct.depth <= ? AND nodes.tenant = ?
+ORDER BY ct.depth, nodes.sort_order ASC, nodes.node_id ASC;`
+
 // DescendantIds behaves the same as Descendants but only returns the node IDs for the search query.
-func (ct *Tree) DescendantIds(ctx context.Context, parent uint, maxDepth int, tenant string) ([]uint, error) {
+func (ct *TreeOf[K]) DescendantIds(ctx context.Context, parent K, maxDepth int, tenant string) ([]K, error) {
 	var err error
 	tenant, err = validateTenant(tenant)
 	if err != nil {
 		return nil, err
 	}
-	ids := []uint{}
+	ids := []K{}
 
 	if maxDepth <= 0 {
 		maxDepth = absMaxDepth
@@ -1038,7 +1330,7 @@ const absMaxDepth = 2147483647
 // parent determines the root node id of to load.
 // maxDepth determines the depth of the relationship to load: 0 means all children, 1 only direct children and so on.
 // tenant determines the tenant to be used
-func (ct *Tree) TreeDescendants(ctx context.Context, parent uint, maxDepth int, tenant string, items any) (err error) {
+func (ct *TreeOf[K]) TreeDescendants(ctx context.Context, parent K, maxDepth int, tenant string, items any) (err error) {
 	if err := validateItems(items); err != nil {
 		return err
 	}
@@ -1074,7 +1366,7 @@ func (ct *Tree) TreeDescendants(ctx context.Context, parent uint, maxDepth int,
 		return fmt.Errorf("failed to read column names: %w", err)
 	}
 
-	nodes, ancestorMap, err := scanRowsToNodes(rows, columns, ct.col2FieldMap, elemType)
+	nodes, ancestorMap, err := scanRowsToNodes[K](rows, columns, ct.col2FieldMap, elemType)
 	if err != nil {
 		return err
 	}
@@ -1108,11 +1400,11 @@ func validateItems(items any) error {
 	return nil
 }
 
-func scanRowsToNodes(rows *sql.Rows, columns []string, col2FieldMap map[string]string, elemType reflect.Type) (
-	map[int64]reflect.Value, map[int64]int64, error,
+func scanRowsToNodes[K ID](rows *sql.Rows, columns []string, col2FieldMap map[string]string, elemType reflect.Type) (
+	map[K]reflect.Value, map[K]K, error,
 ) {
-	nodes := make(map[int64]reflect.Value)
-	ancestorMap := make(map[int64]int64)
+	nodes := make(map[K]reflect.Value)
+	ancestorMap := make(map[K]K)
 
 	for rows.Next() {
 		values := make([]interface{}, len(columns))
@@ -1124,7 +1416,7 @@ func scanRowsToNodes(rows *sql.Rows, columns []string, col2FieldMap map[string]s
 			return nil, nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		node, nodeID, ancestorID, err := mapRowToStruct(values, columns, col2FieldMap, elemType)
+		node, nodeID, ancestorID, err := mapRowToStruct[K](values, columns, col2FieldMap, elemType)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1199,7 +1491,7 @@ func halvingsRemaining(a, b float64) int {
 // upsertMetaHalvings records halvings as the new minimum for (tenant, parentID)
 // if it is lower than the current stored value, or inserts a new row.
 // Must be called inside a transaction.
-func (ct *Tree) upsertMetaHalvings(tx *gorm.DB, parentID uint, tenant string, halvings int) error {
+func (ct *TreeOf[K]) upsertMetaHalvings(tx *gorm.DB, parentID K, tenant string, halvings int) error {
 	// Try to lower the existing value
 	res := tx.Exec(
 		fmt.Sprintf(`UPDATE %s SET min_halvings = ? WHERE tenant = ? AND parent_id = ? AND min_halvings > ?`,
@@ -1211,6 +1503,11 @@ func (ct *Tree) upsertMetaHalvings(tx *gorm.DB, parentID uint, tenant string, ha
 		return nil
 	}
 	// Row doesn't exist or already has equal/lower value — insert, ignore conflict
+	return ct.insertMetaInTx(tx, parentID, tenant, halvings)
+}
+
+// insertMetaInTx inserts the meta row of (tenant, parentID) unless it already exists.
+func (ct *TreeOf[K]) insertMetaInTx(tx *gorm.DB, parentID K, tenant string, halvings int) error {
 	var insertSQL string
 	if isMySQLDialect(tx) {
 		insertSQL = fmt.Sprintf(
@@ -1247,11 +1544,11 @@ func trySetFromString(s string, fieldVal reflect.Value) bool {
 	return false
 }
 
-func mapRowToStruct(values []interface{}, columns []string, col2FieldMap map[string]string, elemType reflect.Type) (
-	reflect.Value, int64, int64, error,
+func mapRowToStruct[K ID](values []interface{}, columns []string, col2FieldMap map[string]string, elemType reflect.Type) (
+	reflect.Value, K, K, error,
 ) {
 	newElem := reflect.New(elemType.Elem())
-	var nodeID, ancestorID int64
+	var nodeID, ancestorID K
 
 	for i, col := range columns {
 		fieldName, ok := col2FieldMap[col]
@@ -1267,22 +1564,22 @@ func mapRowToStruct(values []interface{}, columns []string, col2FieldMap map[str
 		}
 
 		if fieldName == nodeIDField {
-			n, ok := toInt64(value)
+			n, ok := toID[K](value)
 			if !ok {
-				return reflect.Value{}, 0, 0, fmt.Errorf("cannot convert nodeID column value to int64: %T", value)
+				return reflect.Value{}, nodeID, ancestorID, fmt.Errorf("cannot convert nodeID column value to %T: %T", nodeID, value)
 			}
 			nodeID = n
 		}
 		if fieldName == ancestorIDMapKey {
-			n, ok := toInt64(value)
+			n, ok := toID[K](value)
 			if !ok {
-				return reflect.Value{}, 0, 0, fmt.Errorf("cannot convert ancestorID column value to int64: %T", value)
+				return reflect.Value{}, nodeID, ancestorID, fmt.Errorf("cannot convert ancestorID column value to %T: %T", ancestorID, value)
 			}
 			ancestorID = n
 			// Also populate ParentId on the struct so TreeDescendants is
 			// consistent with GetNode and Descendants.
-			if pf := newElem.Elem().FieldByName("ParentId"); pf.IsValid() && pf.CanSet() && n >= 0 {
-				pf.SetUint(uint64(n))
+			if pf := newElem.Elem().FieldByName("ParentId"); pf.IsValid() && pf.CanSet() {
+				pf.Set(reflect.ValueOf(n))
 			}
 		}
 
@@ -1307,18 +1604,18 @@ func mapRowToStruct(values []interface{}, columns []string, col2FieldMap map[str
 		} else if val.Type().ConvertibleTo(fieldVal.Type()) {
 			fieldVal.Set(val.Convert(fieldVal.Type()))
 		} else {
-			return reflect.Value{}, 0, 0, fmt.Errorf("cannot assign type %s to field %s", val.Type(), fieldName)
+			return reflect.Value{}, nodeID, ancestorID, fmt.Errorf("cannot assign type %s to field %s", val.Type(), fieldName)
 		}
 	}
 
 	return newElem, nodeID, ancestorID, nil
 }
 
-func buildTreeHierarchy(nodes map[int64]reflect.Value, ancestorMap map[int64]int64) []reflect.Value {
+func buildTreeHierarchy[K ID](nodes map[K]reflect.Value, ancestorMap map[K]K) []reflect.Value {
 	var roots []reflect.Value
 
 	// Process in sorted key order to ensure deterministic children ordering
-	keys := make([]int64, 0, len(nodes))
+	keys := make([]K, 0, len(nodes))
 	for k := range nodes {
 		keys = append(keys, k)
 	}
@@ -1384,12 +1681,12 @@ const treeDescendantsQuery = `WITH RECURSIVE Tree AS (
 	SELECT  * FROM Tree ORDER BY cte_depth;`
 
 // TreeDescendantsIds returns the tree structure of the descendants to the passed item
-func (ct *Tree) TreeDescendantsIds(ctx context.Context, parent uint, maxDepth int, tenant string) (tree []*TreeNode, err error) {
+func (ct *TreeOf[K]) TreeDescendantsIds(ctx context.Context, parent K, maxDepth int, tenant string) (tree []*TreeNodeOf[K], err error) {
 	tenant, err = validateTenant(tenant)
 	if err != nil {
 		return nil, err
 	}
-	nodeMap := make(map[uint]*TreeNode)
+	nodeMap := make(map[K]*TreeNodeOf[K])
 
 	if maxDepth <= 0 {
 		maxDepth = absMaxDepth
@@ -1408,7 +1705,7 @@ func (ct *Tree) TreeDescendantsIds(ctx context.Context, parent uint, maxDepth in
 	}()
 
 	for rows.Next() {
-		var node TreeNode
+		var node TreeNodeOf[K]
 		err := rows.Scan(&node.NodeId, &node.ParentID, &node.SortOrder)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch tree descendants: %w", err)
@@ -1421,7 +1718,7 @@ func (ct *Tree) TreeDescendantsIds(ctx context.Context, parent uint, maxDepth in
 
 	// Sort keys by (SortOrder ASC, NodeId ASC) so children are appended in order
 	// during assembly — consistent with the strategy in buildTreeHierarchy.
-	keys := make([]uint, 0, len(nodeMap))
+	keys := make([]K, 0, len(nodeMap))
 	for k := range nodeMap {
 		keys = append(keys, k)
 	}
@@ -1436,7 +1733,7 @@ func (ct *Tree) TreeDescendantsIds(ctx context.Context, parent uint, maxDepth in
 
 	// Compose the tree; because keys are pre-sorted, each parent's Children slice
 	// ends up in (SortOrder ASC, NodeId ASC) order without a second pass.
-	var trees []*TreeNode
+	var trees []*TreeNodeOf[K]
 	for _, id := range keys {
 		node := nodeMap[id]
 		if par, exists := nodeMap[node.ParentID]; exists {
@@ -1449,13 +1746,16 @@ func (ct *Tree) TreeDescendantsIds(ctx context.Context, parent uint, maxDepth in
 	return trees, nil
 }
 
-type TreeNode struct {
-	NodeId    uint        `json:"id"`
-	ParentID  uint        `json:"parentId"`
-	SortOrder float64     `json:"sortOrder"`
-	Children  []*TreeNode `json:"children"`
+type TreeNodeOf[K ID] struct {
+	NodeId    K                `json:"id"`
+	ParentID  K                `json:"parentId"`
+	SortOrder float64          `json:"sortOrder"`
+	Children  []*TreeNodeOf[K] `json:"children"`
 }
 
+// TreeNode is the TreeNodeOf of trees with uint IDs.
+type TreeNode = TreeNodeOf[uint]
+
 const treeDescendantsIDQuery = `WITH RECURSIVE Tree AS (
 	-- Base case: Start with direct children of the parent node
 	SELECT
@@ -1482,7 +1782,7 @@ const treeDescendantsIDQuery = `WITH RECURSIVE Tree AS (
 	)
 	SELECT  Tree.node_id, Tree.ancestor_id, Tree.sort_order FROM Tree ORDER BY cte_depth;`
 
-func SortTree(nodes []*TreeNode) {
+func SortTree[K ID](nodes []*TreeNodeOf[K]) {
 	sort.Slice(nodes, func(i, j int) bool {
 		if nodes[i].SortOrder != nodes[j].SortOrder {
 			return nodes[i].SortOrder < nodes[j].SortOrder
@@ -115,6 +115,9 @@ func dropTreeTables(gdb *gorm.DB, model any) {
 	}
 	gdb.Exec("DROP TABLE IF EXISTS closure_tree_rel_" + tbl)
 	gdb.Exec("DROP TABLE IF EXISTS closure_tree_meta_" + tbl)
+	gdb.Exec("DROP TABLE IF EXISTS closure_tree_events_" + tbl)
+	gdb.Exec("DROP TABLE IF EXISTS closure_tree_history_" + tbl)
+	gdb.Exec("DROP TABLE IF EXISTS closure_tree_schema_" + tbl)
 	gdb.Exec("DROP TABLE IF EXISTS " + tbl)
 }
 
@@ -639,6 +642,41 @@ func populateTree(t *testing.T, ct *closuretree.Tree) {
 	}
 }
 
+// largeSubtreeSize is a subtree size beyond the 32766 bound variables sqlite accepts per statement.
+const largeSubtreeSize = 33001
+
+// populateLargeSubtree adds to tenant1 of an empty tree a root node with largeSubtreeSize-1
+// descendants, children with one child each, and returns its ID. The descendants are inserted in
+// batches and linked with Rebuild, adding them one by one is too slow.
+func populateLargeSubtree(t *testing.T, gdb *gorm.DB, ct *closuretree.Tree) uint {
+	t.Helper()
+	ctx := context.Background()
+	top := TestPayload{Name: "large"}
+	if err := ct.Add(ctx, &top, 0, 0, tenant1); err != nil {
+		t.Fatal(err)
+	}
+	newLevel := func(prefix string) []TestPayload {
+		items := make([]TestPayload, (largeSubtreeSize-1)/2)
+		for i := range items {
+			items[i] = TestPayload{Node: closuretree.Node{Tenant: tenant1}, Name: fmt.Sprintf("%s%d", prefix, i)}
+		}
+		if err := gdb.Table(ct.GetNodeTableName()).CreateInBatches(items, 1000).Error; err != nil {
+			t.Fatal(err)
+		}
+		return items
+	}
+	children, grandchildren := newLevel("child"), newLevel("grandchild")
+	parents := map[uint]uint{top.NodeId: 0}
+	for i := range children {
+		parents[children[i].NodeId] = top.NodeId
+		parents[grandchildren[i].NodeId] = children[i].NodeId
+	}
+	if err := ct.Rebuild(ctx, tenant1, parents); err != nil {
+		t.Fatal(err)
+	}
+	return top.NodeId
+}
+
 func TestPopulateTree(t *testing.T) {
 	for _, db := range testdbs.DBs() {
 		t.Run(db.DbType(), func(t *testing.T) {
@@ -1604,6 +1642,47 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteLargeSubtree(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			top := populateLargeSubtree(t, gdb, ct)
+
+			if err := ct.DeleteRecurse(ctx, top, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			ids, err := ct.DescendantIds(ctx, 0, 0, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 0 {
+				t.Errorf("expected no nodes left, got %d", len(ids))
+			}
+			var metaRows int64
+			if err := gdb.Table("closure_tree_meta_test_payloads").Where("tenant = ?", tenant1).Count(&metaRows).Error; err != nil {
+				t.Fatal(err)
+			}
+			// the meta row of the root parent group is kept
+			if metaRows != 1 {
+				t.Errorf("expected only the meta row of the root left, got %d", metaRows)
+			}
+			report, err := ct.Verify(ctx, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Errorf("unexpected integrity problems %+v", report)
+			}
+		})
+	}
+}
+
 func TestIsDescendant(t *testing.T) {
 	for _, db := range testdbs.DBs() {
 		t.Run(db.DbType(), func(t *testing.T) {
@@ -0,0 +1,180 @@
+package closuretree
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDuplicateSibling is returned when a write would leave two children of the same parent
+	// with the same value in Options.UniqueSiblingColumn.
+	ErrDuplicateSibling = errors.New("a sibling with the same value already exists")
+	// ErrMaxDepthExceeded is returned when a write would place a node deeper than Options.MaxDepth.
+	ErrMaxDepthExceeded = errors.New("maximum tree depth exceeded")
+	// ErrMaxChildrenExceeded is returned when a write would give a parent more than Options.MaxChildren children.
+	ErrMaxChildrenExceeded = errors.New("maximum number of children exceeded")
+)
+
+// validateOptions checks the passed Options against the parsed schema of the tree item.
+func validateOptions(stmt *gorm.Statement, opts Options) error {
+	if opts.UniqueSiblingColumn != "" {
+		field, ok := stmt.Schema.FieldsByDBName[opts.UniqueSiblingColumn]
+		if !ok {
+			return fmt.Errorf("unique sibling column %q not found in table %s", opts.UniqueSiblingColumn, stmt.Schema.Table)
+		}
+		if field.OwnerSchema != nil && isNodeType(field.OwnerSchema.ModelType) {
+			return fmt.Errorf("unique sibling column %q must be a payload column", opts.UniqueSiblingColumn)
+		}
+	}
+	if opts.MaxDepth < 0 {
+		return fmt.Errorf("max depth must not be negative, got %d", opts.MaxDepth)
+	}
+	if opts.MaxChildren < 0 {
+		return fmt.Errorf("max children must not be negative, got %d", opts.MaxChildren)
+	}
+	if opts.LeafDeletePolicy < LeafDeleteKeep || opts.LeafDeletePolicy > LeafDeleteRestrict {
+		return fmt.Errorf("unknown leaf delete policy %d", opts.LeafDeletePolicy)
+	}
+	return nil
+}
+
+// enforceConstraints verifies the tree-level constraints configured in Options for node id
+// after it has been written. structural is true when the node was added or moved, in which
+// case the depth and fan-out limits are checked as well.
+// Must be called inside the transaction of the write so that a violation rolls back the
+// whole operation.
+func (ct *TreeOf[K]) enforceConstraints(tx *gorm.DB, id K, tenant string, structural bool) error {
+	if ct.opts.UniqueSiblingColumn != "" {
+		if err := ct.checkUniqueSibling(tx, id, tenant); err != nil {
+			return err
+		}
+	}
+	if !structural {
+		return nil
+	}
+	if ct.opts.MaxDepth > 0 {
+		if err := ct.checkMaxDepth(tx, id, tenant); err != nil {
+			return err
+		}
+	}
+	if ct.opts.MaxChildren > 0 {
+		if err := ct.checkMaxChildren(tx, id, tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockSiblingsInTx serializes the writes that add or move nodes under parentID while a sibling
+// constraint (UniqueSiblingColumn or MaxChildren) is configured, so that the checks of
+// enforceConstraints see the children committed by concurrent transactions.
+// The lock is the meta row of the parent, created if missing, held until the end of tx. It has
+// to be taken before reading the siblings: on MySQL with REPEATABLE READ a transaction keeps the
+// snapshot of its first read.
+// sqlite allows a single writer at a time and needs no row lock.
+func (ct *TreeOf[K]) lockSiblingsInTx(tx *gorm.DB, parentID K, tenant string) error {
+	if ct.opts.UniqueSiblingColumn == "" && ct.opts.MaxChildren == 0 {
+		return nil
+	}
+	if tx.Name() == dialectSqlite {
+		return nil
+	}
+	if err := ct.insertMetaInTx(tx, parentID, tenant, 9999); err != nil {
+		return fmt.Errorf("unable to lock the children of %v: %w", parentID, err)
+	}
+	var halvings int
+	err := tx.Raw(fmt.Sprintf(`SELECT min_halvings FROM %s WHERE tenant = ? AND parent_id = ? FOR UPDATE`, ct.metaTbl),
+		tenant, parentID).Scan(&halvings).Error
+	if err != nil {
+		return fmt.Errorf("unable to lock the children of %v: %w", parentID, err)
+	}
+	return nil
+}
+
+// lockSiblingsOfInTx takes the lock of lockSiblingsInTx on the parent of node id, looked up with
+// a locking read so that it does not start the snapshot of the transaction either.
+func (ct *TreeOf[K]) lockSiblingsOfInTx(tx *gorm.DB, id K, tenant string) error {
+	if tx.Name() == dialectSqlite {
+		return nil
+	}
+	var row struct{ AncestorID K }
+	err := tx.Raw(
+		fmt.Sprintf(`SELECT ancestor_id FROM %s WHERE descendant_id = ? AND depth = 1 AND tenant = ? FOR UPDATE`,
+			ct.relationsTbl),
+		id, tenant,
+	).Scan(&row).Error
+	if err != nil {
+		return fmt.Errorf("unable to lock the siblings of %v: %w", id, err)
+	}
+	return ct.lockSiblingsInTx(tx, row.AncestorID, tenant)
+}
+
+// checkMaxDepth returns ErrMaxDepthExceeded if the deepest node in the subtree of id is
+// on a level beyond Options.MaxDepth. The level of every node is its depth from the root sentinel.
+func (ct *TreeOf[K]) checkMaxDepth(tx *gorm.DB, id K, tenant string) error {
+	var root K
+	var deepest *int
+	err := tx.Raw(fmt.Sprintf(subtreeMaxLevelQuery, ct.relationsTbl, ct.relationsTbl), root, id, tenant).
+		Row().Scan(&deepest)
+	if err != nil {
+		return fmt.Errorf("unable to check tree depth: %w", err)
+	}
+	if deepest != nil && *deepest > ct.opts.MaxDepth {
+		return ErrMaxDepthExceeded
+	}
+	return nil
+}
+
+// checkMaxChildren returns ErrMaxChildrenExceeded if the parent of id has more than
+// Options.MaxChildren direct children.
+func (ct *TreeOf[K]) checkMaxChildren(tx *gorm.DB, id K, tenant string) error {
+	var count int64
+	err := tx.Raw(fmt.Sprintf(siblingCountQuery, ct.relationsTbl, ct.relationsTbl), id, tenant, tenant).
+		Scan(&count).Error
+	if err != nil {
+		return fmt.Errorf("unable to check number of children: %w", err)
+	}
+	if count > int64(ct.opts.MaxChildren) {
+		return ErrMaxChildrenExceeded
+	}
+	return nil
+}
+
+// checkUniqueSibling returns ErrDuplicateSibling if any other child of id's parent has the
+// same value in the unique sibling column.
+func (ct *TreeOf[K]) checkUniqueSibling(tx *gorm.DB, id K, tenant string) error {
+	col := ct.opts.UniqueSiblingColumn
+	var count int64
+	err := tx.Raw(
+		fmt.Sprintf(duplicateSiblingQuery, ct.nodesTbl, ct.relationsTbl, ct.relationsTbl, ct.nodesTbl, col, col),
+		id, tenant,
+	).Scan(&count).Error
+	if err != nil {
+		return fmt.Errorf("unable to check sibling uniqueness: %w", err)
+	}
+	if count > 0 {
+		return ErrDuplicateSibling
+	}
+	return nil
+}
+
+// duplicateSiblingQuery counts the siblings of a node (same depth-1 ancestor) that share the
+// node's value in the given column.
+const duplicateSiblingQuery = `SELECT COUNT(*) FROM %s n
+JOIN %s r ON r.descendant_id = n.node_id AND r.depth = 1 AND r.tenant = n.tenant
+JOIN %s self_rel ON self_rel.ancestor_id = r.ancestor_id AND self_rel.depth = 1 AND self_rel.tenant = n.tenant
+JOIN %s self ON self.node_id = self_rel.descendant_id AND self.tenant = n.tenant
+WHERE self.node_id = ? AND n.tenant = ? AND n.node_id <> self.node_id AND n.%s = self.%s`
+
+// subtreeMaxLevelQuery returns the level (depth from the root) of the deepest node in the
+// subtree of a node, including the node itself.
+const subtreeMaxLevelQuery = `SELECT MAX(lvl.depth) FROM %s sub
+JOIN %s lvl ON lvl.descendant_id = sub.descendant_id AND lvl.ancestor_id = ? AND lvl.tenant = sub.tenant
+WHERE sub.ancestor_id = ? AND sub.tenant = ?`
+
+// siblingCountQuery counts the direct children of a node's parent, including the node itself.
+const siblingCountQuery = `SELECT COUNT(*) FROM %s r
+JOIN %s self_rel ON self_rel.ancestor_id = r.ancestor_id AND self_rel.depth = 1 AND self_rel.tenant = r.tenant
+WHERE self_rel.descendant_id = ? AND self_rel.tenant = ? AND r.depth = 1 AND r.tenant = ?`
@@ -0,0 +1,303 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+)
+
+func TestUniqueSiblingColumn(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			setup := func(t *testing.T) *closuretree.Tree {
+				t.Helper()
+				gdb := connAndClose(t, db)
+				dropTreeTables(gdb, TestPayload{})
+				ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{UniqueSiblingColumn: "name"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				populateTree(t, ct)
+				return ct
+			}
+			ctx := context.Background()
+
+			t.Run("add duplicate under same parent", func(t *testing.T) {
+				ct := setup(t)
+				err := ct.Add(ctx, &TestPayload{Name: "Laptops"}, 1, 0, tenant1)
+				if !errors.Is(err, closuretree.ErrDuplicateSibling) {
+					t.Fatalf("expected ErrDuplicateSibling, got %v", err)
+				}
+				ids, err := ct.DescendantIds(ctx, 1, 1, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(ids) != 2 {
+					t.Errorf("expected the failed add to be rolled back, got children %v", ids)
+				}
+			})
+
+			t.Run("add duplicate at root", func(t *testing.T) {
+				ct := setup(t)
+				err := ct.Add(ctx, &TestPayload{Name: "Clothing"}, 0, 0, tenant1)
+				if !errors.Is(err, closuretree.ErrDuplicateSibling) {
+					t.Fatalf("expected ErrDuplicateSibling, got %v", err)
+				}
+			})
+
+			t.Run("same name under another parent or tenant is allowed", func(t *testing.T) {
+				ct := setup(t)
+				if err := ct.Add(ctx, &TestPayload{Name: "Laptops"}, 3, 0, tenant1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := ct.Add(ctx, &TestPayload{Name: "Electronics"}, 0, 0, tenant2); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+
+			t.Run("rename to a sibling name is rolled back", func(t *testing.T) {
+				ct := setup(t)
+				err := ct.Update(ctx, 2, TestPayload{Name: "Laptops"}, nil, nil, tenant1)
+				if !errors.Is(err, closuretree.ErrDuplicateSibling) {
+					t.Fatalf("expected ErrDuplicateSibling, got %v", err)
+				}
+				assertNodeNameIs(t, ct, 2, tenant1, "Mobile Phones")
+			})
+
+			t.Run("move next to a sibling with the same name is rolled back", func(t *testing.T) {
+				ct := setup(t)
+				laptops := &TestPayload{Name: "Laptops"}
+				if err := ct.Add(ctx, laptops, 3, 0, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				dest := uint(1)
+				err := ct.Update(ctx, laptops.Id(), nil, &dest, nil, tenant1)
+				if !errors.Is(err, closuretree.ErrDuplicateSibling) {
+					t.Fatalf("expected ErrDuplicateSibling, got %v", err)
+				}
+				assertIsDirectChild(t, ct, 3, laptops.Id(), tenant1)
+			})
+
+			t.Run("update keeping its own name is allowed", func(t *testing.T) {
+				ct := setup(t)
+				if err := ct.Update(ctx, 2, TestPayload{Name: "Mobile Phones"}, nil, nil, tenant1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestUniqueSiblingColumnInvalid(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+
+			_, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{UniqueSiblingColumn: "missing"})
+			if err == nil {
+				t.Error("expected error for unknown column, got nil")
+			}
+			_, err = closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{UniqueSiblingColumn: "tenant"})
+			if err == nil {
+				t.Error("expected error for Node column, got nil")
+			}
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			// testTree1 has 3 levels: Electronics > Mobile Phones > Touch Screen
+			setup := func(t *testing.T) *closuretree.Tree {
+				t.Helper()
+				gdb := connAndClose(t, db)
+				dropTreeTables(gdb, TestPayload{})
+				ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{MaxDepth: 3})
+				if err != nil {
+					t.Fatal(err)
+				}
+				populateTree(t, ct)
+				return ct
+			}
+			ctx := context.Background()
+
+			t.Run("add on the last level is allowed", func(t *testing.T) {
+				ct := setup(t)
+				if err := ct.Add(ctx, &TestPayload{Name: "Gaming"}, 4, 0, tenant1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+
+			t.Run("add beyond the last level", func(t *testing.T) {
+				ct := setup(t)
+				err := ct.Add(ctx, &TestPayload{Name: "Glass"}, 6, 0, tenant1)
+				if !errors.Is(err, closuretree.ErrMaxDepthExceeded) {
+					t.Fatalf("expected ErrMaxDepthExceeded, got %v", err)
+				}
+			})
+
+			t.Run("move a subtree so its leaves end up too deep", func(t *testing.T) {
+				ct := setup(t)
+				// moving Mobile Phones (2 levels) under T-Shirt (level 2) would put Touch Screen on level 4
+				dest := uint(5)
+				err := ct.Update(ctx, 2, nil, &dest, nil, tenant1)
+				if !errors.Is(err, closuretree.ErrMaxDepthExceeded) {
+					t.Fatalf("expected ErrMaxDepthExceeded, got %v", err)
+				}
+				assertIsDirectChild(t, ct, 1, 2, tenant1)
+			})
+
+			t.Run("move a subtree within the limit", func(t *testing.T) {
+				ct := setup(t)
+				dest := uint(3)
+				if err := ct.Update(ctx, 2, nil, &dest, nil, tenant1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestMaxChildren(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			// Electronics has 2 children, Clothing has 1
+			setup := func(t *testing.T) *closuretree.Tree {
+				t.Helper()
+				gdb := connAndClose(t, db)
+				dropTreeTables(gdb, TestPayload{})
+				ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{MaxChildren: 2})
+				if err != nil {
+					t.Fatal(err)
+				}
+				populateTree(t, ct)
+				return ct
+			}
+			ctx := context.Background()
+
+			t.Run("add to a full parent", func(t *testing.T) {
+				ct := setup(t)
+				err := ct.Add(ctx, &TestPayload{Name: "Tablets"}, 1, 0, tenant1)
+				if !errors.Is(err, closuretree.ErrMaxChildrenExceeded) {
+					t.Fatalf("expected ErrMaxChildrenExceeded, got %v", err)
+				}
+			})
+
+			t.Run("add to a full root", func(t *testing.T) {
+				ct := setup(t)
+				err := ct.Add(ctx, &TestPayload{Name: "Garden"}, 0, 0, tenant1)
+				if !errors.Is(err, closuretree.ErrMaxChildrenExceeded) {
+					t.Fatalf("expected ErrMaxChildrenExceeded, got %v", err)
+				}
+			})
+
+			t.Run("move into a full parent", func(t *testing.T) {
+				ct := setup(t)
+				dest := uint(1)
+				err := ct.Update(ctx, 5, nil, &dest, nil, tenant1)
+				if !errors.Is(err, closuretree.ErrMaxChildrenExceeded) {
+					t.Fatalf("expected ErrMaxChildrenExceeded, got %v", err)
+				}
+				assertIsDirectChild(t, ct, 3, 5, tenant1)
+			})
+
+			t.Run("reorder inside a full parent is allowed", func(t *testing.T) {
+				ct := setup(t)
+				zero := uint(0)
+				if err := ct.Update(ctx, 2, nil, nil, &zero, tenant1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+
+			t.Run("add to a parent with room", func(t *testing.T) {
+				ct := setup(t)
+				if err := ct.Add(ctx, &TestPayload{Name: "Jeans"}, 3, 0, tenant1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestSiblingConstraintsConcurrent(t *testing.T) {
+	const writers = 8
+	tcs := []struct {
+		name     string
+		opts     closuretree.Options
+		nodeName func(i int) string
+		wantErr  error
+		wantAdds int
+	}{
+		{
+			name:     "unique sibling column",
+			opts:     closuretree.Options{UniqueSiblingColumn: "name"},
+			nodeName: func(i int) string { return "warm" },
+			wantErr:  closuretree.ErrDuplicateSibling,
+			wantAdds: 1,
+		},
+		{
+			name:     "max children",
+			opts:     closuretree.Options{MaxChildren: 4},
+			nodeName: func(i int) string { return fmt.Sprintf("color %d", i) },
+			wantErr:  closuretree.ErrMaxChildrenExceeded,
+			wantAdds: 2, // node 1 already has 2 children
+		},
+	}
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					gdb := connAndClose(t, db)
+					if gdb.Name() == "sqlite" {
+						t.Skip("sqlite allows a single writer, concurrent writes fail with database locked")
+					}
+					dropTreeTables(gdb, TestPayload{})
+					ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, tc.opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					populateTree(t, ct)
+					ctx := context.Background()
+
+					errs := make([]error, writers)
+					var wg sync.WaitGroup
+					for i := range writers {
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							errs[i] = ct.Add(ctx, &TestPayload{Name: tc.nodeName(i)}, 1, 0, tenant1)
+						}()
+					}
+					wg.Wait()
+
+					added := 0
+					for _, err := range errs {
+						switch {
+						case err == nil:
+							added++
+						case !errors.Is(err, tc.wantErr):
+							t.Errorf("expected %v, got %v", tc.wantErr, err)
+						}
+					}
+					if added != tc.wantAdds {
+						t.Errorf("expected %d concurrent adds to succeed, got %d", tc.wantAdds, added)
+					}
+					ids, err := ct.DescendantIds(ctx, 1, 1, tenant1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(ids) != 2+tc.wantAdds {
+						t.Errorf("expected %d children, got %v", 2+tc.wantAdds, ids)
+					}
+				})
+			}
+		})
+	}
+}
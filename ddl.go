@@ -0,0 +1,390 @@
+package closuretree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrUnsupportedDialect is returned by DDL for a dialect other than sqlite, postgres or mysql.
+var ErrUnsupportedDialect = errors.New("unsupported dialect")
+
+// ErrSchemaMismatch is returned by CheckSchema when tables, columns or indexes are missing.
+var ErrSchemaMismatch = errors.New("database schema does not match the tree")
+
+const (
+	dialectSqlite   = "sqlite"
+	dialectPostgres = "postgres"
+	dialectMysql    = "mysql"
+)
+
+// tableModel is a table used by the tree and the model describing it.
+type tableModel struct {
+	name  string
+	model any
+}
+
+// nodeModel returns a new, empty item of the tree.
+func (ct *TreeOf[K]) nodeModel() any {
+	return reflect.New(ct.itemType).Interface()
+}
+
+// tableModels returns the tables of the tree: node, closure, meta and schema, plus the events
+// and history tables when enabled.
+func (ct *TreeOf[K]) tableModels() []tableModel {
+	tables := []tableModel{
+		{name: ct.nodesTbl, model: ct.nodeModel()},
+		{name: ct.relationsTbl, model: &closureTree[K]{}},
+		{name: ct.metaTbl, model: &closureTreeMeta[K]{}},
+		{name: ct.schemaTbl, model: &schemaMigration{}},
+	}
+	if ct.opts.Events {
+		tables = append(tables, tableModel{name: ct.eventsTbl, model: &ChangeEventOf[K]{}})
+	}
+	if ct.opts.History {
+		tables = append(tables, tableModel{name: ct.historyTbl, model: &HistoryEntryOf[K]{}})
+	}
+	return tables
+}
+
+// DDL returns the CREATE TABLE and CREATE INDEX statements of the tables used by the tree, for
+// the dialect as returned by gorm.DB.Name(): "sqlite", "postgres" or "mysql", followed by the
+// INSERT statements recording every migration step up to SchemaVersion in the schema table.
+// The column types match the ones created by Migrate, so a database created with DDL passes
+// CheckSchema and needs no migration.
+// The events and history tables and the parent_id column are included when enabled in the options.
+func (ct *TreeOf[K]) DDL(dialect string) ([]string, error) {
+	switch dialect {
+	case dialectSqlite, dialectPostgres, dialectMysql:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedDialect, dialect)
+	}
+	var stmts []string
+	for _, tbl := range ct.tableModels() {
+		sch, err := ct.parseModel(tbl.model, tbl.name)
+		if err != nil {
+			return nil, err
+		}
+		var extra []string
+		if tbl.name == ct.nodesTbl && ct.opts.StoreParentID {
+			def, err := ct.parentColumnDef(dialect)
+			if err != nil {
+				return nil, err
+			}
+			extra = append(extra, def)
+		}
+		stmts = append(stmts, createTableSQL(dialect, tbl.name, sch, extra...))
+		for _, idx := range sch.ParseIndexes() {
+			stmts = append(stmts, createIndexSQL(dialect, tbl.name, idx))
+		}
+	}
+	if ct.opts.StoreParentID {
+		stmts = append(stmts, ct.parentIndexSQL(dialect))
+	}
+	q := func(name string) string { return quoteIdent(dialect, name) }
+	for _, step := range migrationSteps[K]() {
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (%s, %s, %s) VALUES (%d, %s, CURRENT_TIMESTAMP)",
+			q(ct.schemaTbl), q("version"), q("name"), q("applied_at"), step.version, quoteString(step.name)))
+	}
+	return stmts, nil
+}
+
+// CheckSchema verifies that the tables used by the tree exist with all their columns and
+// indexes and that the recorded schema version is SchemaVersion, it returns ErrSchemaMismatch
+// listing the missing ones or the version behind. Useful at startup together with
+// Options.SkipMigrate.
+func (ct *TreeOf[K]) CheckSchema(ctx context.Context) error {
+	db := ct.db.WithContext(ctx)
+	var missing []string
+	for _, tbl := range ct.tableModels() {
+		if !db.Migrator().HasTable(tbl.name) {
+			missing = append(missing, "table "+tbl.name)
+			continue
+		}
+		sch, err := ct.parseModel(tbl.model, tbl.name)
+		if err != nil {
+			return err
+		}
+		m := db.Table(tbl.name).Migrator()
+		for _, field := range migratedFields(sch) {
+			if !m.HasColumn(tbl.model, field.DBName) {
+				missing = append(missing, fmt.Sprintf("column %s.%s", tbl.name, field.DBName))
+			}
+		}
+		for _, idx := range sch.ParseIndexes() {
+			if !m.HasIndex(tbl.model, idx.Name) {
+				missing = append(missing, fmt.Sprintf("index %s on %s", idx.Name, tbl.name))
+			}
+		}
+	}
+	if ct.opts.StoreParentID && db.Migrator().HasTable(ct.nodesTbl) {
+		m := db.Table(ct.nodesTbl).Migrator()
+		if !m.HasColumn(ct.nodeModel(), parentIDColumn) {
+			missing = append(missing, fmt.Sprintf("column %s.%s", ct.nodesTbl, parentIDColumn))
+		}
+		if !m.HasIndex(ct.nodeModel(), ct.parentIndexName()) {
+			missing = append(missing, fmt.Sprintf("index %s on %s", ct.parentIndexName(), ct.nodesTbl))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrSchemaMismatch, strings.Join(missing, ", "))
+	}
+	version, err := ct.schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version < SchemaVersion {
+		return fmt.Errorf("%w: schema version %d, expected %d", ErrSchemaMismatch, version, SchemaVersion)
+	}
+	return nil
+}
+
+// parseModel parses the model of a table, index names depend on the table name.
+func (ct *TreeOf[K]) parseModel(model any, table string) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: ct.db}
+	if err := stmt.ParseWithSpecialTableName(model, table); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %w", err)
+	}
+	return stmt.Schema, nil
+}
+
+// migratedFields returns the fields stored as columns, in declaration order.
+func migratedFields(sch *schema.Schema) []*schema.Field {
+	var fields []*schema.Field
+	for _, name := range sch.DBNames {
+		field := sch.FieldsByDBName[name]
+		if field.IgnoreMigration {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// createTableSQL returns the CREATE TABLE statement of the model, with the extra column
+// definitions appended to the ones of the fields.
+func createTableSQL(dialect, table string, sch *schema.Schema, extra ...string) string {
+	var defs []string
+	inlinePK := false
+	for _, field := range migratedFields(sch) {
+		colType := columnType(dialect, field)
+		if dialect == dialectSqlite && field.AutoIncrement {
+			colType += " PRIMARY KEY AUTOINCREMENT"
+			inlinePK = true
+		}
+		def := quoteIdent(dialect, field.DBName) + " " + colType
+		if field.NotNull {
+			def += " NOT NULL"
+		}
+		if dflt := defaultValue(field); dflt != "" {
+			def += " DEFAULT " + dflt
+		}
+		defs = append(defs, def)
+	}
+	defs = append(defs, extra...)
+	if !inlinePK && len(sch.PrimaryFields) > 0 {
+		var cols []string
+		for _, field := range sch.PrimaryFields {
+			cols = append(cols, quoteIdent(dialect, field.DBName))
+		}
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(cols, ", ")))
+	}
+	checks := sch.ParseCheckConstraints()
+	for _, name := range slices.Sorted(maps.Keys(checks)) {
+		defs = append(defs, fmt.Sprintf("CONSTRAINT %s CHECK (%s)", quoteIdent(dialect, name), checks[name].Constraint))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(dialect, table), strings.Join(defs, ", "))
+}
+
+// defaultValue returns the SQL literal of the default value of field, empty if it has none.
+func defaultValue(field *schema.Field) string {
+	if !field.HasDefaultValue || field.AutoIncrement {
+		return ""
+	}
+	switch v := field.DefaultValueInterface.(type) {
+	case nil:
+		return field.DefaultValue
+	case string:
+		return quoteString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quoteString returns s as an SQL string literal.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// quoteIdent returns name as a quoted identifier of the dialect, backticks for mysql and double
+// quotes otherwise, so that reserved words like before can be used. Each part of a schema
+// qualified table name is quoted separately.
+func quoteIdent(dialect, name string) string {
+	q := `"`
+	if dialect == dialectMysql {
+		q = "`"
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = q + strings.ReplaceAll(part, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+func createIndexSQL(dialect, table string, idx *schema.Index) string {
+	var cols []string
+	for _, opt := range idx.Fields {
+		cols = append(cols, quoteIdent(dialect, opt.DBName))
+	}
+	unique := ""
+	if idx.Class == "UNIQUE" {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, quoteIdent(dialect, idx.Name), quoteIdent(dialect, table),
+		strings.Join(cols, ", "))
+}
+
+// columnType maps a field to the column type used by the GORM driver of the dialect with its
+// default configuration.
+func columnType(dialect string, field *schema.Field) string {
+	switch dialect {
+	case dialectPostgres:
+		return postgresColumnType(field)
+	case dialectMysql:
+		return mysqlColumnType(field)
+	default:
+		return sqliteColumnType(field)
+	}
+}
+
+func sqliteColumnType(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "numeric"
+	case schema.Int, schema.Uint:
+		return "integer"
+	case schema.Float:
+		return "real"
+	case schema.String:
+		return "text"
+	case schema.Time:
+		return "datetime"
+	case schema.Bytes:
+		return "blob"
+	default:
+		return string(field.DataType)
+	}
+}
+
+func postgresColumnType(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "boolean"
+	case schema.Int, schema.Uint:
+		size := field.Size
+		if field.DataType == schema.Uint {
+			size++
+		}
+		types := []string{"smallint", "integer", "bigint"}
+		if field.AutoIncrement {
+			types = []string{"smallserial", "serial", "bigserial"}
+		}
+		switch {
+		case size <= 16:
+			return types[0]
+		case size <= 32:
+			return types[1]
+		default:
+			return types[2]
+		}
+	case schema.Float:
+		if field.Precision > 0 {
+			return fmt.Sprintf("numeric(%d, %d)", field.Precision, field.Scale)
+		}
+		return "decimal"
+	case schema.String:
+		if field.Size > 0 {
+			return fmt.Sprintf("varchar(%d)", field.Size)
+		}
+		return "text"
+	case schema.Time:
+		return "timestamptz"
+	case schema.Bytes:
+		return "bytea"
+	default:
+		return string(field.DataType)
+	}
+}
+
+func mysqlColumnType(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "boolean"
+	case schema.Int, schema.Uint:
+		var colType string
+		switch {
+		case field.Size <= 8:
+			colType = "tinyint"
+		case field.Size <= 16:
+			colType = "smallint"
+		case field.Size <= 32:
+			colType = "int"
+		default:
+			colType = "bigint"
+		}
+		if field.DataType == schema.Uint {
+			colType += " unsigned"
+		}
+		if field.AutoIncrement {
+			colType += " AUTO_INCREMENT"
+		}
+		return colType
+	case schema.Float:
+		if field.Precision > 0 {
+			return fmt.Sprintf("decimal(%d, %d)", field.Precision, field.Scale)
+		}
+		if field.Size <= 32 {
+			return "float"
+		}
+		return "double"
+	case schema.String:
+		return mysqlStringType(field)
+	case schema.Time:
+		if field.NotNull || field.PrimaryKey {
+			return "datetime(3)"
+		}
+		return "datetime(3) NULL"
+	case schema.Bytes:
+		if field.Size > 0 && field.Size < 65536 {
+			return fmt.Sprintf("varbinary(%d)", field.Size)
+		}
+		return "longblob"
+	default:
+		return string(field.DataType)
+	}
+}
+
+func mysqlStringType(field *schema.Field) string {
+	size := field.Size
+	if size == 0 {
+		hasIndex := field.TagSettings["INDEX"] != "" || field.TagSettings["UNIQUE"] != ""
+		// text columns can't have a default value or be indexed without a length
+		if field.PrimaryKey || field.HasDefaultValue || hasIndex {
+			size = 191
+		}
+	}
+	if size <= 0 || size > 1<<24 {
+		return "longtext"
+	}
+	if size >= 65536 {
+		return "mediumtext"
+	}
+	return fmt.Sprintf("varchar(%d)", size)
+}
@@ -0,0 +1,215 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+)
+
+func TestSkipMigrateAndDDL(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			opts := closuretree.Options{SkipMigrate: true, Events: true, History: true}
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gdb.Migrator().HasTable(ct.GetClosureTableName()) {
+				t.Fatal("expected no tables to be created")
+			}
+			if err := ct.CheckSchema(ctx); !errors.Is(err, closuretree.ErrSchemaMismatch) {
+				t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+			}
+
+			stmts, err := ct.DDL(gdb.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, stmt := range stmts {
+				if err := gdb.Exec(stmt).Error; err != nil {
+					t.Fatalf("unable to run %q: %v", stmt, err)
+				}
+			}
+			if err := ct.CheckSchema(ctx); err != nil {
+				t.Fatal(err)
+			}
+			version, err := ct.CurrentSchemaVersion(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != closuretree.SchemaVersion {
+				t.Errorf("expected schema version %d, got %d", closuretree.SchemaVersion, version)
+			}
+
+			populateTree(t, ct)
+			ids, err := ct.DescendantIds(ctx, 0, 0, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 6 {
+				t.Errorf("expected 6 nodes, got %d", len(ids))
+			}
+
+			// the tables created from the DDL need no migration
+			migrated, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{Events: true, History: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := migrated.CheckSchema(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// ReservedPayload has a column named after a reserved word of every dialect.
+type ReservedPayload struct {
+	closuretree.Node
+	Order int
+}
+
+func TestDDLReservedWords(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, ReservedPayload{})
+			ctx := context.Background()
+
+			opts := closuretree.Options{SkipMigrate: true, Events: true, History: true, StoreParentID: true}
+			ct, err := closuretree.NewWithOptions(gdb, ReservedPayload{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stmts, err := ct.DDL(gdb.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, stmt := range stmts {
+				if err := gdb.Exec(stmt).Error; err != nil {
+					t.Fatalf("unable to run %q: %v", stmt, err)
+				}
+			}
+			if err := ct.CheckSchema(ctx); err != nil {
+				t.Fatal(err)
+			}
+			item := &ReservedPayload{Order: 7}
+			if err := ct.Add(ctx, item, 0, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			history, err := ct.History(ctx, item.Id(), tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 1 || history[0].After != `{"order":7}` {
+				t.Errorf("unexpected history %+v", history)
+			}
+		})
+	}
+}
+
+func TestDDLQuotedIdentifiers(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			naming := func(kind closuretree.TableKind, nodes string) string { return fmt.Sprintf("app1.%s_%s", nodes, kind) }
+			opts := closuretree.Options{SkipMigrate: true, History: true, TableNaming: naming}
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				dialect string
+				want    []string
+			}{
+				{dialect: "sqlite", want: []string{`CREATE TABLE "app1"."test_payloads_history" (`, `"before" text`}},
+				{dialect: "postgres", want: []string{`CREATE TABLE "app1"."test_payloads_history" (`, `"before" text`}},
+				{dialect: "mysql", want: []string{"CREATE TABLE `app1`.`test_payloads_history` (", "`before` text"}},
+			}
+			for _, tc := range tests {
+				stmts, err := ct.DDL(tc.dialect)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ddl := strings.Join(stmts, "\n")
+				for _, want := range tc.want {
+					if !strings.Contains(ddl, want) {
+						t.Errorf("%s: expected the DDL to contain %q, got\n%s", tc.dialect, want, ddl)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSchemaMissingIndex(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.CheckSchema(ctx); err != nil {
+				t.Fatal(err)
+			}
+			relTbl := ct.GetClosureTableName()
+			if err := gdb.Table(relTbl).Migrator().DropIndex(relTbl, "idx_"+relTbl+"_anc_ten_dep"); err != nil {
+				t.Fatal(err)
+			}
+			err = ct.CheckSchema(ctx)
+			if !errors.Is(err, closuretree.ErrSchemaMismatch) || !strings.Contains(err.Error(), "idx_"+relTbl+"_anc_ten_dep") {
+				t.Errorf("expected a mismatch on the anc_ten_dep index, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckSchemaVersionBehind(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = gdb.Exec("DELETE FROM closure_tree_schema_test_payloads WHERE version = ?", closuretree.SchemaVersion).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ct.CheckSchema(ctx)
+			if !errors.Is(err, closuretree.ErrSchemaMismatch) || !strings.Contains(err.Error(), "schema version") {
+				t.Errorf("expected a schema version mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDDLUnsupportedDialect(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{SkipMigrate: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ct.DDL("oracle"); !errors.Is(err, closuretree.ErrUnsupportedDialect) {
+				t.Errorf("expected ErrUnsupportedDialect, got %v", err)
+			}
+		})
+	}
+}
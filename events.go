@@ -0,0 +1,207 @@
+package closuretree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrEventsDisabled is returned by the event API when the tree was created without Options.Events.
+var ErrEventsDisabled = errors.New("change events are not enabled on this tree")
+
+// EventOp identifies the tree operation recorded in a ChangeEvent.
+type EventOp string
+
+const (
+	EventAdd         EventOp = "add"
+	EventUpdate      EventOp = "update"
+	EventMove        EventOp = "move"
+	EventReorder     EventOp = "reorder"
+	EventRenormalize EventOp = "renormalize"
+	EventDelete      EventOp = "delete"
+	// EventTransfer is recorded for every node moved to another tenant by TransferSubtree, with
+	// the target tenant in Tenant and the source tenant in OldTenant.
+	EventTransfer EventOp = "transfer"
+)
+
+// ChangeEventOf is a row of the change-event outbox, written in the same transaction as the change.
+// Parent and position fields are nil when they do not apply to the operation, e.g. OldParentID on add.
+// OldTenant is only set on transfer events.
+type ChangeEventOf[K ID] struct {
+	Seq         uint      `gorm:"primaryKey;autoIncrement" json:"seq"`
+	Op          EventOp   `gorm:"not null;size:32" json:"op"`
+	Tenant      string    `gorm:"not null" json:"tenant"`
+	OldTenant   string    `gorm:"not null;default:''" json:"oldTenant,omitempty"`
+	NodeID      K         `gorm:"not null" json:"nodeId"`
+	OldParentID *K        `json:"oldParentId,omitempty"`
+	NewParentID *K        `json:"newParentId,omitempty"`
+	OldPosition *float64  `json:"oldPosition,omitempty"`
+	NewPosition *float64  `json:"newPosition,omitempty"`
+	CreatedAt   time.Time `gorm:"not null" json:"createdAt"`
+}
+
+// ChangeEvent is the ChangeEventOf of trees with uint IDs.
+type ChangeEvent = ChangeEventOf[uint]
+
+// ReadEvents returns up to limit change events with a sequence number greater than afterSeq,
+// ordered by sequence number. limit <= 0 returns all of them.
+// Events of all tenants are returned, since the outbox is a single log per tree.
+func (ct *TreeOf[K]) ReadEvents(ctx context.Context, afterSeq uint, limit int) ([]ChangeEventOf[K], error) {
+	if !ct.opts.Events {
+		return nil, ErrEventsDisabled
+	}
+	events := []ChangeEventOf[K]{}
+	q := ct.db.WithContext(ctx).Table(ct.eventsTbl).Where("seq > ?", afterSeq).Order("seq ASC")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("ReadEvents: %w", err)
+	}
+	return events, nil
+}
+
+// AckEvents acknowledges all change events up to and including upToSeq by removing them from the outbox.
+// The outbox supports a single consumer: acknowledged events are removed for every reader.
+func (ct *TreeOf[K]) AckEvents(ctx context.Context, upToSeq uint) error {
+	if !ct.opts.Events {
+		return ErrEventsDisabled
+	}
+	err := ct.db.WithContext(ctx).Exec(fmt.Sprintf(`DELETE FROM %s WHERE seq <= ?`, ct.eventsTbl), upToSeq).Error
+	if err != nil {
+		return fmt.Errorf("AckEvents: %w", err)
+	}
+	return nil
+}
+
+// tracksChanges reports whether changes need to be collected for the outbox or the history.
+func (ct *TreeOf[K]) tracksChanges() bool {
+	return ct.opts.Events || ct.opts.History
+}
+
+// recordChanges writes events to the outbox and to the history, whichever is enabled.
+// Must be called inside the transaction of the change.
+func (ct *TreeOf[K]) recordChanges(ctx context.Context, tx *gorm.DB, events []ChangeEventOf[K], snaps payloadSnapshots[K]) error {
+	if err := ct.appendEvents(tx, events...); err != nil {
+		return err
+	}
+	return ct.appendHistory(ctx, tx, events, snaps)
+}
+
+// appendEvents writes events to the outbox, it is a no-op if events are disabled.
+// Must be called inside the transaction of the change.
+func (ct *TreeOf[K]) appendEvents(tx *gorm.DB, events ...ChangeEventOf[K]) error {
+	if !ct.opts.Events || len(events) == 0 {
+		return nil
+	}
+	if err := ct.lockEventsInTx(tx); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for i := range events {
+		events[i].CreatedAt = now
+	}
+	if err := tx.Table(ct.eventsTbl).CreateInBatches(&events, insertBatchSize).Error; err != nil {
+		return fmt.Errorf("unable to append change events: %w", err)
+	}
+	return nil
+}
+
+// lockEventsInTx serializes the transactions appending change events until they end, so that
+// events are committed in sequence order: otherwise a consumer that read up to a sequence
+// number would miss an event with a lower one committed after it.
+// The lock is the row of version 0 in the schema table, created if missing, which is ignored by
+// the schema version. sqlite allows a single writer at a time and needs no row lock.
+func (ct *TreeOf[K]) lockEventsInTx(tx *gorm.DB) error {
+	if tx.Name() == dialectSqlite {
+		return nil
+	}
+	insertSQL := `INSERT INTO %s (version, name, applied_at) VALUES (0, ?, ?) ON CONFLICT (version) DO NOTHING`
+	if isMySQLDialect(tx) {
+		insertSQL = `INSERT INTO %s (version, name, applied_at) VALUES (0, ?, ?) ON DUPLICATE KEY UPDATE version = version`
+	}
+	if err := tx.Exec(fmt.Sprintf(insertSQL, ct.schemaTbl), eventsLockName, time.Now().UTC()).Error; err != nil {
+		return fmt.Errorf("unable to lock the change events: %w", err)
+	}
+	var version int
+	err := tx.Raw(fmt.Sprintf(`SELECT version FROM %s WHERE version = 0 FOR UPDATE`, ct.schemaTbl)).Scan(&version).Error
+	if err != nil {
+		return fmt.Errorf("unable to lock the change events: %w", err)
+	}
+	return nil
+}
+
+// eventsLockName is the name of the schema table row used as lock by lockEventsInTx.
+const eventsLockName = "change events lock"
+
+// updateEvents builds the events of an Update call from its hook event. oldPos is the sort
+// order before the update; the current one is read from tx.
+func (ct *TreeOf[K]) updateEvents(tx *gorm.DB, e HookEventOf[K], fields, moved, reordered bool, oldPos float64) ([]ChangeEventOf[K], error) {
+	var events []ChangeEventOf[K]
+	if fields {
+		events = append(events, ChangeEventOf[K]{Op: EventUpdate, Tenant: e.Tenant, NodeID: e.NodeID})
+	}
+	if !moved && !reordered {
+		return events, nil
+	}
+	newPos, err := ct.sortOrderInTx(tx, e.NodeID, e.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	op := EventReorder
+	if moved {
+		op = EventMove
+	}
+	return append(events, ChangeEventOf[K]{
+		Op: op, Tenant: e.Tenant, NodeID: e.NodeID,
+		OldParentID: ptr(e.OldParentID), NewParentID: ptr(e.NewParentID),
+		OldPosition: ptr(oldPos), NewPosition: ptr(newPos),
+	}), nil
+}
+
+// deleteEvents builds one delete event per node in the subtree of nodeID, it must be called
+// before the nodes are removed.
+func (ct *TreeOf[K]) deleteEvents(tx *gorm.DB, nodeID K, tenant string) ([]ChangeEventOf[K], error) {
+	var rows []struct {
+		NodeID    K
+		ParentID  K
+		SortOrder float64
+	}
+	err := tx.Raw(fmt.Sprintf(subtreeParentsQuery, ct.nodesTbl, ct.relationsTbl, ct.relationsTbl),
+		nodeID, tenant, tenant).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("unable to collect delete events: %w", err)
+	}
+	events := make([]ChangeEventOf[K], 0, len(rows))
+	for _, r := range rows {
+		events = append(events, ChangeEventOf[K]{
+			Op: EventDelete, Tenant: tenant, NodeID: r.NodeID,
+			OldParentID: ptr(r.ParentID), OldPosition: ptr(r.SortOrder),
+		})
+	}
+	return events, nil
+}
+
+// subtreeParentsQuery returns every node of a subtree with its direct parent and sort order,
+// ordered top-down.
+const subtreeParentsQuery = `SELECT n.node_id AS node_id, p.ancestor_id AS parent_id, n.sort_order AS sort_order
+FROM %s n
+JOIN %s sub ON sub.descendant_id = n.node_id AND sub.tenant = n.tenant
+JOIN %s p ON p.descendant_id = n.node_id AND p.depth = 1 AND p.tenant = n.tenant
+WHERE sub.ancestor_id = ? AND sub.tenant = ? AND n.tenant = ?
+ORDER BY sub.depth, n.node_id`
+
+// sortOrderInTx returns the current sort order of node id.
+func (ct *TreeOf[K]) sortOrderInTx(tx *gorm.DB, id K, tenant string) (float64, error) {
+	var sortOrder float64
+	err := tx.Raw(fmt.Sprintf(`SELECT sort_order FROM %s WHERE node_id = ? AND tenant = ?`, ct.nodesTbl), id, tenant).
+		Scan(&sortOrder).Error
+	return sortOrder, err
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,233 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestChangeEvents(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{Events: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			a := &TestPayload{Name: "a"}
+			if err := ct.Add(ctx, a, 0, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			b := &TestPayload{Name: "b"}
+			if err := ct.Add(ctx, b, 0, a.Id(), tenant1); err != nil {
+				t.Fatal(err)
+			}
+			c := &TestPayload{Name: "c"}
+			if err := ct.Add(ctx, c, b.Id(), 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			// rename and move c under a
+			dest := a.Id()
+			if err := ct.Update(ctx, c.Id(), TestPayload{Name: "c2"}, &dest, nil, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			// place b first
+			zero := uint(0)
+			if err := ct.Update(ctx, b.Id(), nil, nil, &zero, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.Renormalize(ctx, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.DeleteRecurse(ctx, a.Id(), tenant1); err != nil {
+				t.Fatal(err)
+			}
+			// a failed write must not leave an event behind
+			if err := ct.Add(ctx, &TestPayload{Name: "x"}, 999, 0, tenant1); !errors.Is(err, closuretree.ErrParentNotFound) {
+				t.Fatalf("expected ErrParentNotFound, got %v", err)
+			}
+
+			got, err := ct.ReadEvents(ctx, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []closuretree.ChangeEvent{
+				{Op: closuretree.EventAdd, Tenant: tenant1, NodeID: a.Id(), NewParentID: uintPtr(0), NewPosition: floatPtr(0)},
+				{Op: closuretree.EventAdd, Tenant: tenant1, NodeID: b.Id(), NewParentID: uintPtr(0), NewPosition: floatPtr(10)},
+				{Op: closuretree.EventAdd, Tenant: tenant1, NodeID: c.Id(), NewParentID: uintPtr(b.Id()), NewPosition: floatPtr(0)},
+				{Op: closuretree.EventUpdate, Tenant: tenant1, NodeID: c.Id()},
+				{Op: closuretree.EventMove, Tenant: tenant1, NodeID: c.Id(),
+					OldParentID: uintPtr(b.Id()), NewParentID: uintPtr(a.Id()), OldPosition: floatPtr(0), NewPosition: floatPtr(0)},
+				{Op: closuretree.EventReorder, Tenant: tenant1, NodeID: b.Id(),
+					OldParentID: uintPtr(0), NewParentID: uintPtr(0), OldPosition: floatPtr(10), NewPosition: floatPtr(-10)},
+				{Op: closuretree.EventRenormalize, Tenant: tenant1, NodeID: b.Id(),
+					OldParentID: uintPtr(0), NewParentID: uintPtr(0), OldPosition: floatPtr(-10), NewPosition: floatPtr(10)},
+				{Op: closuretree.EventRenormalize, Tenant: tenant1, NodeID: a.Id(),
+					OldParentID: uintPtr(0), NewParentID: uintPtr(0), OldPosition: floatPtr(0), NewPosition: floatPtr(20)},
+				{Op: closuretree.EventDelete, Tenant: tenant1, NodeID: a.Id(), OldParentID: uintPtr(0), OldPosition: floatPtr(20)},
+				{Op: closuretree.EventDelete, Tenant: tenant1, NodeID: c.Id(), OldParentID: uintPtr(a.Id()), OldPosition: floatPtr(0)},
+			}
+			if diff := cmp.Diff(got, want, cmpopts.IgnoreFields(closuretree.ChangeEvent{}, "Seq", "CreatedAt")); diff != "" {
+				t.Errorf("unexpected events (-got +want):\n%s", diff)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Seq <= got[i-1].Seq {
+					t.Errorf("expected increasing sequence numbers, got %d after %d", got[i].Seq, got[i-1].Seq)
+				}
+			}
+
+			t.Run("read after a sequence with limit", func(t *testing.T) {
+				page, err := ct.ReadEvents(ctx, got[1].Seq, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page) != 2 || page[0].Seq != got[2].Seq {
+					t.Errorf("unexpected page %+v", page)
+				}
+			})
+
+			t.Run("ack removes consumed events", func(t *testing.T) {
+				if err := ct.AckEvents(ctx, got[4].Seq); err != nil {
+					t.Fatal(err)
+				}
+				rest, err := ct.ReadEvents(ctx, 0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(rest) != len(got)-5 || rest[0].Seq != got[5].Seq {
+					t.Errorf("unexpected events after ack %+v", rest)
+				}
+			})
+		})
+	}
+}
+
+func TestChangeEventsLargeSubtree(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{Events: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			top := populateLargeSubtree(t, gdb, ct)
+			added, err := ct.ReadEvents(ctx, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ct.DeleteRecurse(ctx, top, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			events, err := ct.ReadEvents(ctx, added[len(added)-1].Seq, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != largeSubtreeSize {
+				t.Fatalf("expected %d delete events, got %d", largeSubtreeSize, len(events))
+			}
+			if events[0].NodeID != top || events[len(events)-1].Op != closuretree.EventDelete {
+				t.Errorf("expected the delete of %d first, got %+v", top, events[0])
+			}
+		})
+	}
+}
+
+func TestChangeEventsDisabled(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ct.ReadEvents(context.Background(), 0, 10); !errors.Is(err, closuretree.ErrEventsDisabled) {
+				t.Errorf("expected ErrEventsDisabled, got %v", err)
+			}
+			if err := ct.AckEvents(context.Background(), 10); !errors.Is(err, closuretree.ErrEventsDisabled) {
+				t.Errorf("expected ErrEventsDisabled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChangeEventsConcurrent(t *testing.T) {
+	const writers = 20
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			if gdb.Name() == "sqlite" {
+				t.Skip("sqlite allows a single writer, concurrent writes fail with database locked")
+			}
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{Events: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			var wg sync.WaitGroup
+			for i := range writers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := ct.Add(ctx, &TestPayload{Name: fmt.Sprintf("node %d", i)}, 0, 0, tenant1); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			// a consumer reading after the last seen sequence number must not skip any event
+			var lastSeq uint
+			seen := 0
+			read := func() {
+				events, err := ct.ReadEvents(ctx, lastSeq, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, e := range events {
+					lastSeq = e.Seq
+					seen++
+				}
+			}
+			for running := true; running; {
+				select {
+				case <-done:
+					running = false
+				default:
+					read()
+				}
+			}
+			read()
+			if seen != writers {
+				t.Errorf("expected the consumer to see %d events, got %d", writers, seen)
+			}
+		})
+	}
+}
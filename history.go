@@ -0,0 +1,178 @@
+package closuretree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrHistoryDisabled is returned by History when the tree was created without Options.History.
+var ErrHistoryDisabled = errors.New("history is not enabled on this tree")
+
+// HistoryEntryOf is a single change of a node in the audit history.
+// Before and After hold a JSON snapshot of the payload columns for add, update and delete entries;
+// move, reorder and renormalize entries record the parent and position change instead, transfer
+// entries the source tenant in OldTenant as well.
+type HistoryEntryOf[K ID] struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Tenant      string    `gorm:"not null;index:,composite:hist_ten_node" json:"tenant"`
+	NodeID      K         `gorm:"not null;index:,composite:hist_ten_node" json:"nodeId"`
+	OldTenant   string    `gorm:"not null;default:''" json:"oldTenant,omitempty"`
+	Op          EventOp   `gorm:"not null;size:32" json:"op"`
+	Actor       string    `gorm:"not null;default:''" json:"actor"`
+	Before      string    `gorm:"type:text" json:"before,omitempty"`
+	After       string    `gorm:"type:text" json:"after,omitempty"`
+	OldParentID *K        `json:"oldParentId,omitempty"`
+	NewParentID *K        `json:"newParentId,omitempty"`
+	OldPosition *float64  `json:"oldPosition,omitempty"`
+	NewPosition *float64  `json:"newPosition,omitempty"`
+	CreatedAt   time.Time `gorm:"not null" json:"createdAt"`
+}
+
+// HistoryEntry is the HistoryEntryOf of trees with uint IDs.
+type HistoryEntry = HistoryEntryOf[uint]
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying actor, it is stored with every history entry written
+// by tree operations called with that context.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor, or an empty string if none was set.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// History returns the audit history of a node ordered from oldest to newest.
+// The history of deleted nodes is kept and can still be queried, the history of nodes moved with
+// TransferSubtree moves with them to the new tenant.
+func (ct *TreeOf[K]) History(ctx context.Context, nodeID K, tenant string) ([]HistoryEntryOf[K], error) {
+	if !ct.opts.History {
+		return nil, ErrHistoryDisabled
+	}
+	var err error
+	tenant, err = validateTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	entries := []HistoryEntryOf[K]{}
+	err = ct.db.WithContext(ctx).Table(ct.historyTbl).
+		Where("tenant = ? AND node_id = ?", tenant, nodeID).
+		Order("id ASC").
+		Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("History: %w", err)
+	}
+	return entries, nil
+}
+
+// payloadSnapshots holds the JSON encoded payload columns of nodes, keyed by node ID.
+type payloadSnapshots[K ID] struct {
+	before map[K]string
+	after  map[K]string
+}
+
+// appendHistory writes one history entry per event, taking the actor from ctx, it is a no-op if
+// history is disabled. Must be called inside the transaction of the change.
+func (ct *TreeOf[K]) appendHistory(ctx context.Context, tx *gorm.DB, events []ChangeEventOf[K], snaps payloadSnapshots[K]) error {
+	if !ct.opts.History || len(events) == 0 {
+		return nil
+	}
+	actor := ActorFromContext(ctx)
+	now := time.Now().UTC()
+	entries := make([]HistoryEntryOf[K], 0, len(events))
+	for _, e := range events {
+		entry := HistoryEntryOf[K]{
+			Tenant: e.Tenant, NodeID: e.NodeID, OldTenant: e.OldTenant, Op: e.Op, Actor: actor,
+			OldParentID: e.OldParentID, NewParentID: e.NewParentID,
+			OldPosition: e.OldPosition, NewPosition: e.NewPosition,
+			CreatedAt: now,
+		}
+		switch e.Op {
+		case EventAdd:
+			entry.After = snaps.after[e.NodeID]
+		case EventUpdate:
+			entry.Before = snaps.before[e.NodeID]
+			entry.After = snaps.after[e.NodeID]
+		case EventDelete:
+			entry.Before = snaps.before[e.NodeID]
+		}
+		entries = append(entries, entry)
+	}
+	if err := tx.Table(ct.historyTbl).CreateInBatches(&entries, insertBatchSize).Error; err != nil {
+		return fmt.Errorf("unable to append history: %w", err)
+	}
+	return nil
+}
+
+// insertBatchSize is the number of history or event rows inserted per statement, the rows of a
+// large subtree exceed the bound variables a database accepts in a single statement.
+const insertBatchSize = 1000
+
+// snapshotPayloads returns the JSON encoded payload columns of the passed nodes, it returns
+// nil if history is disabled.
+func (ct *TreeOf[K]) snapshotPayloads(tx *gorm.DB, tenant string, ids ...K) (map[K]string, error) {
+	if !ct.opts.History || len(ids) == 0 {
+		return nil, nil
+	}
+	return ct.snapshotRows(tx.Table(ct.nodesTbl).Where("tenant = ? AND node_id IN ?", tenant, ids))
+}
+
+// snapshotSubtreePayloads returns the snapshots of snapshotPayloads for every node in the subtree
+// of nodeID, selected through the closure table so that the query size does not grow with the
+// subtree.
+func (ct *TreeOf[K]) snapshotSubtreePayloads(tx *gorm.DB, tenant string, nodeID K) (map[K]string, error) {
+	if !ct.opts.History {
+		return nil, nil
+	}
+	return ct.snapshotRows(tx.Table(ct.nodesTbl).Where(
+		fmt.Sprintf("tenant = ? AND node_id IN (SELECT descendant_id FROM %s WHERE ancestor_id = ? AND tenant = ?)", ct.relationsTbl),
+		tenant, nodeID, tenant))
+}
+
+// snapshotRows encodes the payload columns of the nodes selected by query.
+func (ct *TreeOf[K]) snapshotRows(query *gorm.DB) (map[K]string, error) {
+	var rows []map[string]any
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("unable to snapshot nodes: %w", err)
+	}
+	snaps := make(map[K]string, len(rows))
+	for _, row := range rows {
+		id, ok := toID[K](row[nodeIdDBField])
+		if !ok {
+			return nil, fmt.Errorf("cannot convert nodeID column value to %T: %T", id, row[nodeIdDBField])
+		}
+		payload := make(map[string]any, len(row))
+		for col, val := range row {
+			if isNodeColumn(col) {
+				continue
+			}
+			if b, ok := val.([]byte); ok {
+				val = string(b)
+			}
+			payload[col] = val
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode snapshot of node %v: %w", id, err)
+		}
+		snaps[id] = string(data)
+	}
+	return snaps, nil
+}
+
+// isNodeColumn reports whether col is one of the columns managed through the embedded Node.
+func isNodeColumn(col string) bool {
+	switch col {
+	case nodeIdDBField, "parent_id", "tenant", "sort_order":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestHistory(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{History: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := closuretree.WithActor(context.Background(), "alice")
+
+			colors := &TestPayload{Name: "colors"}
+			if err := ct.Add(ctx, colors, 0, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			warm := &TestPayload{Name: "warm"}
+			if err := ct.Add(ctx, warm, 0, colors.Id(), tenant1); err != nil {
+				t.Fatal(err)
+			}
+			bob := closuretree.WithActor(context.Background(), "bob")
+			dest := colors.Id()
+			if err := ct.Update(bob, warm.Id(), TestPayload{Name: "warm colors"}, &dest, nil, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			// a failed write must not be recorded
+			bad := uint(999)
+			if err := ct.Update(bob, warm.Id(), TestPayload{Name: "lost"}, &bad, nil, tenant1); !errors.Is(err, closuretree.ErrParentNotFound) {
+				t.Fatalf("expected ErrParentNotFound, got %v", err)
+			}
+			if err := ct.DeleteRecurse(bob, colors.Id(), tenant1); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ct.History(context.Background(), warm.Id(), tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []closuretree.HistoryEntry{
+				{Tenant: tenant1, NodeID: warm.Id(), Op: closuretree.EventAdd, Actor: "alice",
+					After: `{"name":"warm"}`, NewParentID: uintPtr(0), NewPosition: floatPtr(10)},
+				{Tenant: tenant1, NodeID: warm.Id(), Op: closuretree.EventUpdate, Actor: "bob",
+					Before: `{"name":"warm"}`, After: `{"name":"warm colors"}`},
+				{Tenant: tenant1, NodeID: warm.Id(), Op: closuretree.EventMove, Actor: "bob",
+					OldParentID: uintPtr(0), NewParentID: uintPtr(colors.Id()), OldPosition: floatPtr(10), NewPosition: floatPtr(10)},
+				{Tenant: tenant1, NodeID: warm.Id(), Op: closuretree.EventDelete, Actor: "bob",
+					Before: `{"name":"warm colors"}`, OldParentID: uintPtr(colors.Id()), OldPosition: floatPtr(10)},
+			}
+			if diff := cmp.Diff(got, want, cmpopts.IgnoreFields(closuretree.HistoryEntry{}, "ID", "CreatedAt")); diff != "" {
+				t.Errorf("unexpected history (-got +want):\n%s", diff)
+			}
+
+			other, err := ct.History(context.Background(), warm.Id(), tenant2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(other) != 0 {
+				t.Errorf("expected no history in another tenant, got %d entries", len(other))
+			}
+		})
+	}
+}
+
+func TestHistoryLargeSubtree(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{History: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			top := populateLargeSubtree(t, gdb, ct)
+			ids, err := ct.DescendantIds(ctx, top, 0, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := ids[len(ids)-1]
+
+			if err := ct.DeleteRecurse(ctx, top, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ct.History(ctx, last, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].Op != closuretree.EventDelete || got[0].Before == "" {
+				t.Errorf("expected the delete of node %d with its payload, got %+v", last, got)
+			}
+		})
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ct.History(context.Background(), 1, tenant1); !errors.Is(err, closuretree.ErrHistoryDisabled) {
+				t.Errorf("expected ErrHistoryDisabled, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package closuretree
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// HookEventOf describes the tree operation a lifecycle hook is called for.
+type HookEventOf[K ID] struct {
+	// Tx is the transaction of the operation, use it for any write that must be atomic with the change.
+	Tx     *gorm.DB
+	Tenant string
+	// NodeID is the node being added, moved or reordered, or the root of the deleted subtree.
+	// It is the zero value in BeforeAdd since the node has not been created yet.
+	NodeID K
+	// Item is the item passed to Add or Update; nil if the operation was called without one.
+	Item any
+	// OldParentID is the parent before a move or reorder.
+	OldParentID K
+	// NewParentID is the parent after an add, move or reorder.
+	NewParentID K
+	// AfterNodeID is the sibling the node was placed after, the zero value means first.
+	AfterNodeID K
+	// DeletedIDs holds the IDs of all nodes removed by DeleteRecurse, including NodeID.
+	DeletedIDs []K
+}
+
+// HookEvent is the HookEventOf of trees with uint IDs.
+type HookEvent = HookEventOf[uint]
+
+// BeforeAddHookOf is called by Add before the node is created; returning an error aborts the add.
+type BeforeAddHookOf[K ID] interface {
+	BeforeAdd(ctx context.Context, e HookEventOf[K]) error
+}
+
+// BeforeAddHook is the BeforeAddHookOf of trees with uint IDs.
+type BeforeAddHook = BeforeAddHookOf[uint]
+
+// AfterAddHookOf is called by Add once the node and its relations are stored; returning an error rolls back the add.
+type AfterAddHookOf[K ID] interface {
+	AfterAdd(ctx context.Context, e HookEventOf[K]) error
+}
+
+// AfterAddHook is the AfterAddHookOf of trees with uint IDs.
+type AfterAddHook = AfterAddHookOf[uint]
+
+// BeforeMoveHookOf is called by Update before a node is moved to a new parent; returning an error aborts the update.
+type BeforeMoveHookOf[K ID] interface {
+	BeforeMove(ctx context.Context, e HookEventOf[K]) error
+}
+
+// BeforeMoveHook is the BeforeMoveHookOf of trees with uint IDs.
+type BeforeMoveHook = BeforeMoveHookOf[uint]
+
+// AfterMoveHookOf is called by Update once a node was moved to a new parent; returning an error rolls back the update.
+type AfterMoveHookOf[K ID] interface {
+	AfterMove(ctx context.Context, e HookEventOf[K]) error
+}
+
+// AfterMoveHook is the AfterMoveHookOf of trees with uint IDs.
+type AfterMoveHook = AfterMoveHookOf[uint]
+
+// AfterReorderHookOf is called by Update once the sort order of a node was changed; returning an error rolls back the update.
+type AfterReorderHookOf[K ID] interface {
+	AfterReorder(ctx context.Context, e HookEventOf[K]) error
+}
+
+// AfterReorderHook is the AfterReorderHookOf of trees with uint IDs.
+type AfterReorderHook = AfterReorderHookOf[uint]
+
+// BeforeDeleteHookOf is called by DeleteRecurse before any node is removed; returning an error aborts the delete.
+type BeforeDeleteHookOf[K ID] interface {
+	BeforeDelete(ctx context.Context, e HookEventOf[K]) error
+}
+
+// BeforeDeleteHook is the BeforeDeleteHookOf of trees with uint IDs.
+type BeforeDeleteHook = BeforeDeleteHookOf[uint]
+
+// AfterDeleteHookOf is called by DeleteRecurse once the nodes are removed; returning an error rolls back the delete.
+type AfterDeleteHookOf[K ID] interface {
+	AfterDelete(ctx context.Context, e HookEventOf[K]) error
+}
+
+// AfterDeleteHook is the AfterDeleteHookOf of trees with uint IDs.
+type AfterDeleteHook = AfterDeleteHookOf[uint]
+
+// RegisterListener adds a listener that is called on every tree operation for each of the hook
+// interfaces it implements, e.g. AfterAddHook. Listeners run after the hooks implemented by the
+// item type, in the order they were registered.
+// RegisterListener is not safe for concurrent use with tree operations, register all listeners
+// at start-up.
+func (ct *TreeOf[K]) RegisterListener(listener any) {
+	ct.listeners = append(ct.listeners, listener)
+}
+
+// hookTargets returns the values hooks are looked up on: a pointer to the item, or to a zero value
+// of the tree item type if item is nil, followed by the registered listeners.
+func (ct *TreeOf[K]) hookTargets(item any) []any {
+	var target reflect.Value
+	if item == nil {
+		target = reflect.New(ct.itemType)
+	} else {
+		v := reflect.ValueOf(item)
+		if v.Kind() == reflect.Ptr {
+			target = v
+		} else {
+			target = reflect.New(v.Type())
+			target.Elem().Set(v)
+		}
+	}
+	return append([]any{target.Interface()}, ct.listeners...)
+}
+
+// callHooks calls fn on every target implementing the hook interface H, stopping at the first error.
+func callHooks[H any](targets []any, name string, fn func(H) error) error {
+	for _, target := range targets {
+		h, ok := target.(H)
+		if !ok {
+			continue
+		}
+		if err := fn(h); err != nil {
+			return fmt.Errorf("%s hook: %w", name, err)
+		}
+	}
+	return nil
+}
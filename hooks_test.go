@@ -0,0 +1,214 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+)
+
+var errForbiddenName = errors.New("forbidden name")
+
+// HookedPayload vetoes adding nodes named "forbidden" through an item-type hook.
+type HookedPayload struct {
+	closuretree.Node
+	Name string
+}
+
+func (p *HookedPayload) BeforeAdd(_ context.Context, _ closuretree.HookEvent) error {
+	if p.Name == "forbidden" {
+		return errForbiddenName
+	}
+	return nil
+}
+
+// recordingListener records every hook call as a short string.
+type recordingListener struct {
+	calls     []string
+	vetoMove  bool
+	vetoAfter bool
+}
+
+func (l *recordingListener) AfterAdd(_ context.Context, e closuretree.HookEvent) error {
+	l.calls = append(l.calls, fmt.Sprintf("AfterAdd %d parent=%d", e.NodeID, e.NewParentID))
+	if l.vetoAfter {
+		return errForbiddenName
+	}
+	return nil
+}
+
+func (l *recordingListener) BeforeMove(_ context.Context, e closuretree.HookEvent) error {
+	l.calls = append(l.calls, fmt.Sprintf("BeforeMove %d %d->%d", e.NodeID, e.OldParentID, e.NewParentID))
+	if l.vetoMove {
+		return errForbiddenName
+	}
+	return nil
+}
+
+func (l *recordingListener) AfterMove(_ context.Context, e closuretree.HookEvent) error {
+	l.calls = append(l.calls, fmt.Sprintf("AfterMove %d %d->%d", e.NodeID, e.OldParentID, e.NewParentID))
+	return nil
+}
+
+func (l *recordingListener) AfterReorder(_ context.Context, e closuretree.HookEvent) error {
+	l.calls = append(l.calls, fmt.Sprintf("AfterReorder %d parent=%d after=%d", e.NodeID, e.NewParentID, e.AfterNodeID))
+	return nil
+}
+
+func (l *recordingListener) BeforeDelete(_ context.Context, e closuretree.HookEvent) error {
+	l.calls = append(l.calls, fmt.Sprintf("BeforeDelete %d %v", e.NodeID, e.DeletedIDs))
+	return nil
+}
+
+func (l *recordingListener) AfterDelete(_ context.Context, e closuretree.HookEvent) error {
+	l.calls = append(l.calls, fmt.Sprintf("AfterDelete %d %v", e.NodeID, e.DeletedIDs))
+	return nil
+}
+
+func TestItemHooks(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, HookedPayload{})
+			ct, err := closuretree.New(gdb, HookedPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			if err := ct.Add(ctx, HookedPayload{Name: "allowed"}, 0, 0, tenant1); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = ct.Add(ctx, HookedPayload{Name: "forbidden"}, 0, 0, tenant1)
+			if !errors.Is(err, errForbiddenName) {
+				t.Fatalf("expected errForbiddenName, got %v", err)
+			}
+			ids, err := ct.DescendantIds(ctx, 0, 0, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 1 {
+				t.Errorf("expected the vetoed add to leave 1 node, got %v", ids)
+			}
+		})
+	}
+}
+
+func TestListenerHooks(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			setup := func(t *testing.T) (*closuretree.Tree, *recordingListener) {
+				t.Helper()
+				gdb := connAndClose(t, db)
+				dropTreeTables(gdb, TestPayload{})
+				ct, err := closuretree.New(gdb, TestPayload{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				populateTree(t, ct)
+				l := &recordingListener{}
+				ct.RegisterListener(l)
+				return ct, l
+			}
+			ctx := context.Background()
+
+			t.Run("add", func(t *testing.T) {
+				ct, l := setup(t)
+				item := &TestPayload{Name: "Tablets"}
+				if err := ct.Add(ctx, item, 1, 0, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				want := []string{fmt.Sprintf("AfterAdd %d parent=1", item.Id())}
+				if diff := cmp.Diff(l.calls, want); diff != "" {
+					t.Errorf("unexpected calls (-got +want):\n%s", diff)
+				}
+			})
+
+			t.Run("after hook error rolls back the add", func(t *testing.T) {
+				ct, l := setup(t)
+				l.vetoAfter = true
+				err := ct.Add(ctx, &TestPayload{Name: "Tablets"}, 1, 0, tenant1)
+				if !errors.Is(err, errForbiddenName) {
+					t.Fatalf("expected errForbiddenName, got %v", err)
+				}
+				ids, err := ct.DescendantIds(ctx, 1, 1, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(ids) != 2 {
+					t.Errorf("expected the add to be rolled back, got children %v", ids)
+				}
+			})
+
+			t.Run("move and reorder", func(t *testing.T) {
+				ct, l := setup(t)
+				dest := uint(3)
+				after := uint(5)
+				if err := ct.Update(ctx, 2, nil, &dest, &after, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				want := []string{
+					"BeforeMove 2 1->3",
+					"AfterMove 2 1->3",
+					"AfterReorder 2 parent=3 after=5",
+				}
+				if diff := cmp.Diff(l.calls, want); diff != "" {
+					t.Errorf("unexpected calls (-got +want):\n%s", diff)
+				}
+			})
+
+			t.Run("reorder only", func(t *testing.T) {
+				ct, l := setup(t)
+				zero := uint(0)
+				if err := ct.Update(ctx, 2, nil, nil, &zero, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				want := []string{"AfterReorder 2 parent=1 after=0"}
+				if diff := cmp.Diff(l.calls, want); diff != "" {
+					t.Errorf("unexpected calls (-got +want):\n%s", diff)
+				}
+			})
+
+			t.Run("vetoed move is rolled back", func(t *testing.T) {
+				ct, l := setup(t)
+				l.vetoMove = true
+				dest := uint(3)
+				err := ct.Update(ctx, 2, TestPayload{Name: "Should Not Persist"}, &dest, nil, tenant1)
+				if !errors.Is(err, errForbiddenName) {
+					t.Fatalf("expected errForbiddenName, got %v", err)
+				}
+				assertIsDirectChild(t, ct, 1, 2, tenant1)
+				assertNodeNameIs(t, ct, 2, tenant1, "Mobile Phones")
+			})
+
+			t.Run("delete", func(t *testing.T) {
+				ct, l := setup(t)
+				if err := ct.DeleteRecurse(ctx, 2, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				want := []string{
+					"BeforeDelete 2 [2 6]",
+					"AfterDelete 2 [2 6]",
+				}
+				if diff := cmp.Diff(l.calls, want); diff != "" {
+					t.Errorf("unexpected calls (-got +want):\n%s", diff)
+				}
+			})
+
+			t.Run("delete of a missing node calls no hook", func(t *testing.T) {
+				ct, l := setup(t)
+				err := ct.DeleteRecurse(ctx, 99, tenant1)
+				if !errors.Is(err, closuretree.ErrNodeNotFound) {
+					t.Fatalf("expected ErrNodeNotFound, got %v", err)
+				}
+				if len(l.calls) != 0 {
+					t.Errorf("expected no hook calls, got %v", l.calls)
+				}
+			})
+		})
+	}
+}
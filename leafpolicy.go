@@ -0,0 +1,71 @@
+package closuretree
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrNodeHasLeaves is returned by DeleteRecurse under LeafDeleteRestrict when a leaf is attached
+// to any node of the deleted subtree.
+var ErrNodeHasLeaves = errors.New("node has leaves attached")
+
+// LeafDeletePolicy defines how DeleteRecurse treats the join rows of registered leaves.
+type LeafDeletePolicy int
+
+const (
+	// LeafDeleteKeep leaves the join rows untouched, they keep pointing at the deleted nodes.
+	LeafDeleteKeep LeafDeletePolicy = iota
+	// LeafDeleteCascade removes the join rows of the deleted nodes, the leaves themselves are kept.
+	LeafDeleteCascade
+	// LeafDeleteReattach attaches the leaves of the deleted nodes to the parent of the deleted
+	// subtree instead; when a root node is deleted the join rows are removed like LeafDeleteCascade.
+	LeafDeleteReattach
+	// LeafDeleteRestrict refuses to delete a subtree with attached leaves with ErrNodeHasLeaves.
+	LeafDeleteRestrict
+)
+
+// applyLeafDeletePolicy handles the join rows of registered leaves pointing at the nodes of the
+// subtree of nodeID that is about to be deleted. The subtree is read from the closure table, so
+// this has to run before its rows are deleted.
+func (ct *TreeOf[K]) applyLeafDeletePolicy(tx *gorm.DB, nodeID K, tenant string) error {
+	if ct.opts.LeafDeletePolicy == LeafDeleteKeep {
+		return nil
+	}
+	parentID, err := ct.parentIDInTx(tx, nodeID, tenant)
+	if err != nil {
+		return err
+	}
+	subtree := fmt.Sprintf(`SELECT descendant_id FROM %s WHERE ancestor_id = ? AND tenant = ?`, ct.relationsTbl)
+	for _, join := range ct.leaves {
+		inSubtree := fmt.Sprintf("%s IN (%s)", join.nodeCol, subtree)
+		var leafIDs []uint
+		err := tx.Table(join.joinTbl).Where(inSubtree, nodeID, tenant).
+			Distinct(join.leafCol).Pluck(join.leafCol, &leafIDs).Error
+		if err != nil {
+			return fmt.Errorf("deleteRecurse: unable to load attached leaves: %w", err)
+		}
+		if len(leafIDs) == 0 {
+			continue
+		}
+		if ct.opts.LeafDeletePolicy == LeafDeleteRestrict {
+			return fmt.Errorf("%w: %d leaves of %s", ErrNodeHasLeaves, len(leafIDs), join.leafTbl)
+		}
+		err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s`, join.joinTbl, inSubtree), nodeID, tenant).Error
+		if err != nil {
+			return fmt.Errorf("deleteRecurse: unable to detach leaves: %w", err)
+		}
+		if ct.opts.LeafDeletePolicy != LeafDeleteReattach || isRoot(parentID) {
+			continue
+		}
+		links := make([]LeafLinkOf[K], 0, len(leafIDs))
+		for _, leafID := range leafIDs {
+			links = append(links, LeafLinkOf[K]{LeafID: leafID, NodeID: parentID})
+		}
+		if err := insertLeafLinks(tx, join, links); err != nil {
+			return fmt.Errorf("deleteRecurse: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestLeafDeletePolicy(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			newLeaves := func() []TestLeaf {
+				return []TestLeaf{
+					{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone"},
+					{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone shirt"},
+					{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "both"},
+					{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "laptop"},
+				}
+			}
+			nodes := [][]uint{{6}, {2, 5}, {2, 6}, {4}}
+			ctx := context.Background()
+
+			tcs := []struct {
+				name     string
+				policy   closuretree.LeafDeletePolicy
+				deleteID uint
+				tenant   string
+				// want holds the nodes of every leaf after the delete, in leaf order
+				want    [][]uint
+				wantErr error
+			}{
+				{name: "keep", policy: closuretree.LeafDeleteKeep, deleteID: 2, want: [][]uint{{6}, {2, 5}, {2, 6}, {4}}},
+				{name: "cascade", policy: closuretree.LeafDeleteCascade, deleteID: 2, want: [][]uint{nil, {5}, nil, {4}}},
+				{name: "reattach", policy: closuretree.LeafDeleteReattach, deleteID: 2, want: [][]uint{{1}, {1, 5}, {1}, {4}}},
+				{name: "reattach root", policy: closuretree.LeafDeleteReattach, deleteID: 1, want: [][]uint{nil, {5}, nil, nil}},
+				{
+					name: "restrict", policy: closuretree.LeafDeleteRestrict, deleteID: 2,
+					want: [][]uint{{6}, {2, 5}, {2, 6}, {4}}, wantErr: closuretree.ErrNodeHasLeaves,
+				},
+				{name: "restrict without leaves", policy: closuretree.LeafDeleteRestrict, deleteID: 7, tenant: tenant2, want: nodes},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					leaves := newLeaves()
+					ct, gdb := setupLeavesTree(t, db, closuretree.Options{LeafDeletePolicy: tc.policy}, leaves, nodes)
+					tenant := tenant1
+					if tc.tenant != "" {
+						tenant = tc.tenant
+					}
+					err := ct.DeleteRecurse(ctx, tc.deleteID, tenant)
+					if !errors.Is(err, tc.wantErr) {
+						t.Fatalf("expected %v, got %v", tc.wantErr, err)
+					}
+					var got [][]uint
+					for _, leaf := range leaves {
+						got = append(got, leafNodeIDs(t, gdb, leaf.Id()))
+					}
+					if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
+						t.Errorf("unexpected leaf nodes (-got +want):\n%s", diff)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestLeafDeletePolicyLargeSubtree(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			gdb.Exec("DROP TABLE IF EXISTS test_leaf_nodes")
+			gdb.Exec("DROP TABLE IF EXISTS test_leafs")
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{LeafDeletePolicy: closuretree.LeafDeleteCascade})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.AutoMigrate(&TestLeaf{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.RegisterLeaves(TestLeaf{}); err != nil {
+				t.Fatal(err)
+			}
+			top := populateLargeSubtree(t, gdb, ct)
+			ids, err := ct.DescendantIds(ctx, top, 0, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf := TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "deep"}
+			if err := gdb.Create(&leaf).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.SetLeafNodes(ctx, TestLeaf{}, leaf.Id(), ids[len(ids)-1:], tenant1); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ct.DeleteRecurse(ctx, top, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			if got := leafNodeIDs(t, gdb, leaf.Id()); len(got) != 0 {
+				t.Errorf("expected the leaf to be detached, got %v", got)
+			}
+		})
+	}
+}
+
+func TestLeafDeletePolicyInvalid(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			_, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{LeafDeletePolicy: 42})
+			if err == nil {
+				t.Error("expected an error for an unknown leaf delete policy")
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package closuretree
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type leafCondOp int
+
+const (
+	leafCondNone leafCondOp = iota
+	leafCondUnder
+	leafCondAnd
+	leafCondOr
+	leafCondNot
+)
+
+// LeafCondOf is a boolean condition on the nodes a leaf is attached to, built with Under and
+// combined with And, Or and Not. The zero value matches every leaf.
+type LeafCondOf[K ID] struct {
+	op       leafCondOp
+	nodeID   K
+	children []LeafCondOf[K]
+}
+
+// LeafCond is the LeafCondOf of trees with uint IDs.
+type LeafCond = LeafCondOf[uint]
+
+// Under matches leaves attached to nodeID or to any of its descendants, Under(0) matches leaves
+// attached to any node.
+func Under(nodeID uint) LeafCond {
+	return UnderOf(nodeID)
+}
+
+// UnderOf is Under for trees with node IDs of type K, e.g. UnderOf("a1b2") with string keys.
+func UnderOf[K ID](nodeID K) LeafCondOf[K] {
+	return LeafCondOf[K]{op: leafCondUnder, nodeID: nodeID}
+}
+
+// And matches leaves matching both c and o.
+func (c LeafCondOf[K]) And(o LeafCondOf[K]) LeafCondOf[K] {
+	if c.op == leafCondNone {
+		return o
+	}
+	return LeafCondOf[K]{op: leafCondAnd, children: []LeafCondOf[K]{c, o}}
+}
+
+// Or matches leaves matching c or o.
+func (c LeafCondOf[K]) Or(o LeafCondOf[K]) LeafCondOf[K] {
+	if c.op == leafCondNone {
+		return o
+	}
+	return LeafCondOf[K]{op: leafCondOr, children: []LeafCondOf[K]{c, o}}
+}
+
+// Not matches leaves matching c but not o.
+func (c LeafCondOf[K]) Not(o LeafCondOf[K]) LeafCondOf[K] {
+	return c.And(LeafCondOf[K]{op: leafCondNot, children: []LeafCondOf[K]{o}})
+}
+
+// sql compiles the condition into a WHERE expression on the leaf table.
+func (c LeafCondOf[K]) sql(join leafJoin, relationsTbl, tenant string) (string, []any) {
+	switch c.op {
+	case leafCondUnder:
+		return fmt.Sprintf(leafUnderQuery, join.leafTbl, leafIDDBField, join.leafCol, join.joinTbl, relationsTbl, join.nodeCol),
+			[]any{c.nodeID, tenant}
+	case leafCondAnd, leafCondOr:
+		left, leftArgs := c.children[0].sql(join, relationsTbl, tenant)
+		right, rightArgs := c.children[1].sql(join, relationsTbl, tenant)
+		op := "AND"
+		if c.op == leafCondOr {
+			op = "OR"
+		}
+		return fmt.Sprintf("(%s %s %s)", left, op, right), append(leftArgs, rightArgs...)
+	case leafCondNot:
+		inner, args := c.children[0].sql(join, relationsTbl, tenant)
+		return fmt.Sprintf("(NOT %s)", inner), args
+	default:
+		return "1 = 1", nil
+	}
+}
+
+// leafUnderQuery selects the leaves attached to a node or any of its descendants.
+const leafUnderQuery = `%s.%s IN (SELECT j.%s FROM %s j
+JOIN %s r ON r.descendant_id = j.%s
+WHERE r.ancestor_id = ? AND r.tenant = ?)`
+
+// LeafQueryOf finds leaves with a boolean combination of subtree conditions, e.g. the books tagged
+// with a tag below a or below b, but not below c:
+//
+//	ct.LeafQuery().Under(a).Or(closuretree.Under(b)).Not(closuretree.Under(c)).Find(ctx, &books, tenant)
+//
+// Conditions are combined left to right, ((a OR b) AND NOT c) in the example; nest LeafCond values
+// for other groupings. Only leaves of the tenant are returned.
+type LeafQueryOf[K ID] struct {
+	ct     *TreeOf[K]
+	cond   LeafCondOf[K]
+	scopes []func(*gorm.DB) *gorm.DB
+}
+
+// LeafQuery is the LeafQueryOf of trees with uint IDs.
+type LeafQuery = LeafQueryOf[uint]
+
+// LeafQuery returns a new, empty leaf query, which matches every leaf of the tenant.
+func (ct *TreeOf[K]) LeafQuery() *LeafQueryOf[K] {
+	return &LeafQueryOf[K]{ct: ct}
+}
+
+// Under adds the condition Under(nodeID) with AND.
+func (q *LeafQueryOf[K]) Under(nodeID K) *LeafQueryOf[K] {
+	return q.And(UnderOf(nodeID))
+}
+
+// And adds c with AND.
+func (q *LeafQueryOf[K]) And(c LeafCondOf[K]) *LeafQueryOf[K] {
+	q.cond = q.cond.And(c)
+	return q
+}
+
+// Or adds c with OR.
+func (q *LeafQueryOf[K]) Or(c LeafCondOf[K]) *LeafQueryOf[K] {
+	q.cond = q.cond.Or(c)
+	return q
+}
+
+// Not adds c with AND NOT.
+func (q *LeafQueryOf[K]) Not(c LeafCondOf[K]) *LeafQueryOf[K] {
+	q.cond = q.cond.Not(c)
+	return q
+}
+
+// Scopes adds GORM scopes applied to the leaf model query, e.g. to filter on leaf columns.
+func (q *LeafQueryOf[K]) Scopes(fns ...func(*gorm.DB) *gorm.DB) *LeafQueryOf[K] {
+	q.scopes = append(q.scopes, fns...)
+	return q
+}
+
+// Find loads the matching leaves of tenant into target, a pointer to a slice of leaves.
+func (q *LeafQueryOf[K]) Find(ctx context.Context, target any, tenant string, opts ...LeavesOptions) error {
+	if err := isLeaveSlice(target); err != nil {
+		return err
+	}
+	db, join, err := q.build(ctx, target, tenant)
+	if err != nil {
+		return err
+	}
+	for _, o := range opts {
+		if db, err = applyLeavesOptions(db, join, o); err != nil {
+			return err
+		}
+	}
+	return db.Preload(join.fieldName).Find(target).Error
+}
+
+// Count returns the number of matching leaves of type leafModel, e.g. Book{}, in tenant.
+func (q *LeafQueryOf[K]) Count(ctx context.Context, leafModel any, tenant string) (int64, error) {
+	db, _, err := q.build(ctx, leafSlicePtr(leafModel), tenant)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := db.Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("LeafQuery.Count: %w", err)
+	}
+	return count, nil
+}
+
+func (q *LeafQueryOf[K]) build(ctx context.Context, target any, tenant string) (*gorm.DB, leafJoin, error) {
+	tenant, err := validateTenant(tenant)
+	if err != nil {
+		return nil, leafJoin{}, err
+	}
+	join, err := q.ct.resolveLeafJoin(target)
+	if err != nil {
+		return nil, leafJoin{}, err
+	}
+	where, args := q.cond.sql(join, q.ct.relationsTbl, tenant)
+	db := q.ct.db.WithContext(ctx).Model(target).Scopes(q.scopes...).
+		Where(fmt.Sprintf("%s.%s = ?", join.leafTbl, leafTenantDBField), tenant).
+		Where(where, args...)
+	return db, join, nil
+}
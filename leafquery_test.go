@@ -0,0 +1,66 @@
+package closuretree_test
+
+import (
+	"context"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/gorm"
+)
+
+func TestLeafQuery(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			leaves := []TestLeaf{
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "laptop"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone shirt"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "shirt"},
+				{Leaf: closuretree.Leaf{Tenant: tenant2}, Name: "red"},
+			}
+			ct, _ := setupLeavesTree(t, db, closuretree.Options{}, leaves, [][]uint{{4}, {6}, {2, 5}, {5}, {12}})
+			ctx := context.Background()
+			phones := func(db *gorm.DB) *gorm.DB { return db.Where("name LIKE ?", "phone%") }
+
+			tcs := []struct {
+				name  string
+				query *closuretree.LeafQuery
+				want  []string
+			}{
+				{name: "under", query: ct.LeafQuery().Under(1), want: []string{"laptop", "phone", "phone shirt"}},
+				{name: "or", query: ct.LeafQuery().Under(2).Or(closuretree.Under(3)), want: []string{"phone", "phone shirt", "shirt"}},
+				{name: "and", query: ct.LeafQuery().Under(1).And(closuretree.Under(3)), want: []string{"phone shirt"}},
+				{name: "and not", query: ct.LeafQuery().Under(1).Not(closuretree.Under(2)), want: []string{"laptop"}},
+				{name: "not only", query: ct.LeafQuery().Not(closuretree.Under(1)), want: []string{"shirt"}},
+				{
+					name:  "nested",
+					query: ct.LeafQuery().Under(4).Or(closuretree.Under(2).And(closuretree.Under(3))),
+					want:  []string{"laptop", "phone shirt"},
+				},
+				{name: "scopes", query: ct.LeafQuery().Under(1).Scopes(phones), want: []string{"phone", "phone shirt"}},
+				{name: "empty matches the tenant", query: ct.LeafQuery(), want: []string{"laptop", "phone", "phone shirt", "shirt"}},
+				{name: "node of other tenant", query: ct.LeafQuery().Under(7), want: []string{}},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					var got []TestLeaf
+					if err := tc.query.Find(ctx, &got, tenant1, closuretree.LeavesOptions{OrderBy: "name"}); err != nil {
+						t.Fatal(err)
+					}
+					if diff := cmp.Diff(leafNames(got), tc.want); diff != "" {
+						t.Errorf("unexpected leaves (-got +want):\n%s", diff)
+					}
+					count, err := tc.query.Count(ctx, TestLeaf{}, tenant1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if count != int64(len(tc.want)) {
+						t.Errorf("expected count %d, got %d", len(tc.want), count)
+					}
+				})
+			}
+		})
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"reflect"
 	"strings"
 
-	"github.com/jinzhu/inflection"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 // Leaf is an embeddable ID to be used in closure tree, this is mandatory if you want to use leaves functionality
@@ -23,7 +23,8 @@ func (n *Leaf) Id() uint {
 
 var ErrItemIsNotTreeLeaf = errors.New("the item does not embed Leaf")
 
-// isLeaveSlice uses reflection to verify if the passed item is a pointer to a slice that embedded Leaf struct
+// isLeaveSlice uses reflection to verify if the passed item is a pointer to a slice of structs, or of
+// pointers to structs, that embed Leaf (at any level) and have a slice field with a many2many gorm tag.
 // returns an error for every condition checked, returns nil if the passed item is as expected
 func isLeaveSlice(item any) error {
 	if item == nil {
@@ -45,128 +46,473 @@ func isLeaveSlice(item any) error {
 
 	// Get the element type of the slice
 	elemType := sliceType.Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
 	if elemType.Kind() != reflect.Struct {
 		return fmt.Errorf("item is not a slice of structs")
 	}
 
-	// Check if the struct embeds Leaf
-	hasLeaf := false
-	hasManyToMany := false
+	if !hasLeafType(elemType) {
+		return ErrItemIsNotTreeLeaf
+	}
+	if !hasManyToManyField(elemType) {
+		return fmt.Errorf("item struct does not contain a many2many gorm tag")
+	}
+	return nil
+}
 
-	for i := 0; i < elemType.NumField(); i++ {
-		field := elemType.Field(i)
+// hasLeafType reports whether t is Leaf or embeds it, directly or through other embedded structs.
+func hasLeafType(t reflect.Type) bool {
+	if t == reflect.TypeOf(Leaf{}) {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && hasLeafType(f.Type) {
+			return true
+		}
+	}
+	return false
+}
 
-		// Check if the struct embeds Leaf
-		if field.Anonymous && field.Type == reflect.TypeOf(Leaf{}) {
-			hasLeaf = true
+// hasManyToManyField reports whether t, or any struct embedded in it, has a slice field with a
+// gorm "many2many" annotation.
+func hasManyToManyField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Slice && strings.Contains(f.Tag.Get("gorm"), "many2many:") {
+			return true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && hasManyToManyField(f.Type) {
+			return true
 		}
+	}
+	return false
+}
+
+const nodeIdDBField = "node_id"
+const leafIDDBField = "leaf_id"
+const leafTenantDBField = "tenant"
+
+// leafJoin describes how a leaf model is linked to the tree nodes through its many2many join table.
+type leafJoin struct {
+	fieldName string // name of the many2many field on the leaf, used for preloading
+	leafTbl   string
+	joinTbl   string
+	leafCol   string // join table column referencing the leaf
+	nodeCol   string // join table column referencing the node
+	schema    *schema.Schema
+}
+
+// resolveLeafJoin returns the join information of a leaf model, model can be a leaf struct,
+// a pointer to it or a pointer to a slice of it.
+func (ct *TreeOf[K]) resolveLeafJoin(model any) (leafJoin, error) {
+	target := leafSlicePtr(model)
+	if err := isLeaveSlice(target); err != nil {
+		return leafJoin{}, err
+	}
+
+	stmt := &gorm.Statement{DB: ct.db}
+	if err := stmt.Parse(target); err != nil {
+		return leafJoin{}, fmt.Errorf("error parsing schema: %w", err)
+	}
+	leaveTblName := stmt.Schema.Table
 
-		// Check if the struct has a slice field with a gorm "many2many" annotation
-		if field.Type.Kind() == reflect.Slice {
-			gormTag := field.Tag.Get("gorm")
-			if strings.Contains(gormTag, "many2many:") {
-				hasManyToMany = true
+	rel, err := ct.nodeRelation(stmt.Schema)
+	if err != nil {
+		return leafJoin{}, err
+	}
+	fieldName := rel.Name
+	join := leafJoin{
+		fieldName: fieldName,
+		leafTbl:   leaveTblName,
+		joinTbl:   rel.JoinTable.Table,
+		schema:    stmt.Schema,
+	}
+	// The join columns are taken from the parsed relation, so joinForeignKey/joinReferences tags
+	// and join models set up with gorm.DB.SetupJoinTable are honored.
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			if ref.PrimaryKey.DBName != leafIDDBField {
+				return leafJoin{}, fmt.Errorf("many2many relation %s must reference %s.%s", fieldName, leaveTblName, leafIDDBField)
+			}
+			join.leafCol = ref.ForeignKey.DBName
+		} else {
+			if ref.PrimaryKey.DBName != nodeIdDBField {
+				return leafJoin{}, fmt.Errorf("many2many relation %s must reference %s.%s", fieldName, rel.FieldSchema.Table, nodeIdDBField)
 			}
+			join.nodeCol = ref.ForeignKey.DBName
 		}
 	}
+	for _, name := range []string{join.joinTbl, join.leafTbl, join.leafCol, join.nodeCol} {
+		if err := validateTableName(name); err != nil {
+			return leafJoin{}, err
+		}
+	}
+	return join, nil
+}
 
-	if !hasLeaf {
-		return ErrItemIsNotTreeLeaf
+// nodeRelation returns the many2many relation of the leaf schema s whose target is the node table of
+// this tree, a leaf can be linked to several trees through different fields.
+func (ct *TreeOf[K]) nodeRelation(s *schema.Schema) (*schema.Relationship, error) {
+	var found *schema.Relationship
+	for _, rel := range s.Relationships.Many2Many {
+		if rel.JoinTable == nil || rel.FieldSchema == nil || rel.FieldSchema.Table != ct.nodesTbl {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s has more than one many2many relation to %s: %s and %s",
+				s.Name, ct.nodesTbl, found.Name, rel.Name)
+		}
+		found = rel
 	}
+	if found == nil {
+		return nil, fmt.Errorf("%s has no many2many relation to %s", s.Name, ct.nodesTbl)
+	}
+	return found, nil
+}
 
-	if !hasManyToMany {
-		return fmt.Errorf("item struct does not contain a many2many gorm tag")
+// leafSlicePtr returns model unchanged if it is a pointer to a slice, otherwise it returns a
+// pointer to a new slice of the (dereferenced) model type.
+func leafSlicePtr(model any) any {
+	if model == nil {
+		return nil
 	}
-	return nil
+	t := reflect.TypeOf(model)
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
+		return model
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.New(reflect.SliceOf(t)).Interface()
 }
 
-func getGormM2MTblName(item any) (string, string, error) {
-	if item == nil {
-		return "", "", fmt.Errorf("item is nil")
+// RegisterLeaves registers the leaf models linked to this tree, e.g. Book{}, so that operations
+// changing the tree structure can keep their many2many join rows consistent.
+// RegisterLeaves is not safe for concurrent use with tree operations, register all leaf models
+// at start-up.
+func (ct *TreeOf[K]) RegisterLeaves(models ...any) error {
+	for _, model := range models {
+		join, err := ct.resolveLeafJoin(model)
+		if err != nil {
+			return err
+		}
+		ct.leaves = append(ct.leaves, join)
 	}
+	return nil
+}
 
-	itemType := reflect.TypeOf(item)
+// ErrInvalidLeavesOptions is returned when LeavesOptions refer to an unknown column or combine
+// keyset pagination with a custom ordering.
+var ErrInvalidLeavesOptions = errors.New("invalid leaves options")
+
+// LeavesOptions controls ordering and pagination of GetLeaves.
+type LeavesOptions struct {
+	// OrderBy is a column or field name of the leaf model, defaults to the leaf ID.
+	OrderBy string
+	// Desc sorts in descending order.
+	Desc bool
+	// Limit is the maximum number of leaves returned, 0 means no limit.
+	Limit int
+	// Offset skips the first leaves, prefer AfterLeafID for deep pages.
+	Offset int
+	// AfterLeafID enables keyset pagination: only leaves after this ID, in the sort direction, are
+	// returned. It can only be used when ordering by the leaf ID.
+	AfterLeafID uint
+	// Exclude inverts the node match: GetLeaves returns the leaves of the tenant that are not
+	// attached to parentID nor to any of its descendants up to maxDepth, including leaves
+	// attached to no node at all.
+	Exclude bool
+}
 
-	// Dereference the pointer to get the slice type
-	sliceType := itemType.Elem()
-	elemType := sliceType.Elem()
+// GetLeaves loads into target, a pointer to a slice of leaves, all leaves of tenant attached to
+// parentID or to any of its descendants up to maxDepth. The optional LeavesOptions define
+// ordering, pagination and exclusion; without them the order is unspecified.
+func (ct *TreeOf[K]) GetLeaves(ctx context.Context, target any, parentID K, maxDepth int, tenant string, opts ...LeavesOptions) error {
+	err := isLeaveSlice(target)
+	if err != nil {
+		return err
+	}
+	exclude := false
+	for _, o := range opts {
+		exclude = exclude || o.Exclude
+	}
+	q, join, err := ct.leavesQuery(ctx, target, parentID, maxDepth, tenant, exclude)
+	if err != nil {
+		return err
+	}
+	for _, o := range opts {
+		if q, err = applyLeavesOptions(q, join, o); err != nil {
+			return err
+		}
+	}
+	return q.Preload(join.fieldName).Distinct().Find(target).Error
+}
 
-	// Iterate over the struct fields to find the many2many annotation
-	for i := 0; i < elemType.NumField(); i++ {
-		field := elemType.Field(i)
+// CountLeaves returns the number of distinct leaves of type leafModel, e.g. Book{}, that GetLeaves
+// would return without pagination.
+func (ct *TreeOf[K]) CountLeaves(ctx context.Context, leafModel any, parentID K, maxDepth int, tenant string) (int64, error) {
+	q, join, err := ct.leavesQuery(ctx, leafSlicePtr(leafModel), parentID, maxDepth, tenant, false)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = q.Distinct(fmt.Sprintf("%s.%s", join.leafTbl, leafIDDBField)).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("CountLeaves: %w", err)
+	}
+	return count, nil
+}
 
-		// Check if the field is a slice and has a gorm tag
-		if field.Type.Kind() == reflect.Slice {
-			gormTag := field.Tag.Get("gorm")
+// leavesQuery returns a query on the leaves of target attached to parentID or its descendants,
+// or with exclude on the leaves of the tenant not attached to any of them.
+func (ct *TreeOf[K]) leavesQuery(ctx context.Context, target any, parentID K, maxDepth int, tenant string,
+	exclude bool) (*gorm.DB, leafJoin, error) {
+	tenant, err := validateTenant(tenant)
+	if err != nil {
+		return nil, leafJoin{}, err
+	}
+	join, err := ct.resolveLeafJoin(target)
+	if err != nil {
+		return nil, leafJoin{}, err
+	}
+	ids, err := ct.DescendantIds(ctx, parentID, maxDepth, tenant)
+	if err != nil {
+		return nil, leafJoin{}, err
+	}
+	if !isRoot(parentID) {
+		ids = append(ids, parentID)
+	}
 
-			// Extract the many2many table name
-			if strings.Contains(gormTag, "many2many:") {
-				parts := strings.Split(gormTag, ";")
-				for _, part := range parts {
-					if strings.HasPrefix(part, "many2many:") {
+	if exclude {
+		q := ct.db.WithContext(ctx).Model(target).
+			Where(fmt.Sprintf("%s.%s = ?", join.leafTbl, leafTenantDBField), tenant)
+		if len(ids) > 0 {
+			q = q.Where(fmt.Sprintf(leavesNotAttachedQuery, join.leafTbl, leafIDDBField, join.leafCol, join.joinTbl, join.nodeCol), ids)
+		}
+		return q, join, nil
+	}
+	joinSql := fmt.Sprintf(leavesJoinQuery, join.joinTbl, join.leafTbl, leafIDDBField, join.joinTbl, join.leafCol)
+	q := ct.db.WithContext(ctx).Model(target).InnerJoins(joinSql).
+		Where(fmt.Sprintf(leavesWhereQuery, join.joinTbl, join.nodeCol, join.leafTbl), ids, tenant)
+	return q, join, nil
+}
 
-						return field.Name, strings.TrimPrefix(part, "many2many:"), nil
-					}
-				}
-			}
+// applyLeavesOptions adds the ordering and pagination of o to q.
+func applyLeavesOptions(q *gorm.DB, join leafJoin, o LeavesOptions) (*gorm.DB, error) {
+	col := leafIDDBField
+	if o.OrderBy != "" {
+		field := join.schema.LookUpField(o.OrderBy)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: unknown order column %q", ErrInvalidLeavesOptions, o.OrderBy)
 		}
+		col = field.DBName
+	}
+	if o.AfterLeafID != 0 && col != leafIDDBField {
+		return nil, fmt.Errorf("%w: AfterLeafID requires ordering by %s", ErrInvalidLeavesOptions, leafIDDBField)
+	}
+	if o.Limit < 0 || o.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit and offset must not be negative", ErrInvalidLeavesOptions)
+	}
+
+	dir, cmpOp := "ASC", ">"
+	if o.Desc {
+		dir, cmpOp = "DESC", "<"
+	}
+	if o.AfterLeafID != 0 {
+		q = q.Where(fmt.Sprintf("%s.%s %s ?", join.leafTbl, leafIDDBField, cmpOp), o.AfterLeafID)
+	}
+	q = q.Order(fmt.Sprintf("%s.%s %s", join.leafTbl, col, dir))
+	if col != leafIDDBField {
+		// tie-breaker for a stable order across pages
+		q = q.Order(fmt.Sprintf("%s.%s %s", join.leafTbl, leafIDDBField, dir))
+	}
+	if o.Limit > 0 {
+		q = q.Limit(o.Limit)
 	}
-	return "", "", fmt.Errorf("many2many annotation not found")
+	if o.Offset > 0 {
+		q = q.Offset(o.Offset)
+	}
+	return q, nil
 }
 
-const nodeIdDBField = "node_id"
-const leafIDDBField = "leaf_id"
+const leavesJoinQuery = `INNER JOIN %s ON %s.%s = %s.%s`
+const leavesWhereQuery = `%s.%s IN ? AND %s.tenant = ?`
+const leavesNotAttachedQuery = `%s.%s NOT IN (SELECT %s FROM %s WHERE %s IN ?)`
 
-func (ct *Tree) GetLeaves(ctx context.Context, target any, parentID uint, maxDepth int, tenant string) error {
+// UntaggedLeaves loads into target, a pointer to a slice of leaves, the leaves of tenant that are
+// not attached to any node of the tenant. Join rows pointing at deleted nodes are ignored.
+func (ct *TreeOf[K]) UntaggedLeaves(ctx context.Context, target any, tenant string, opts ...LeavesOptions) error {
+	if err := isLeaveSlice(target); err != nil {
+		return err
+	}
 	tenant, err := validateTenant(tenant)
 	if err != nil {
 		return err
 	}
-
-	ids, err := ct.DescendantIds(ctx, parentID, maxDepth, tenant)
+	join, err := ct.resolveLeafJoin(target)
 	if err != nil {
 		return err
 	}
-	if parentID != 0 {
-		ids = append(ids, parentID)
+	q := ct.db.WithContext(ctx).Model(target).
+		Where(fmt.Sprintf("%s.%s = ?", join.leafTbl, leafTenantDBField), tenant).
+		Where(fmt.Sprintf(untaggedLeavesQuery, join.leafTbl, leafIDDBField, join.leafCol, join.joinTbl, ct.nodesTbl,
+			join.nodeCol), tenant)
+	for _, o := range opts {
+		if o.Exclude {
+			return fmt.Errorf("%w: Exclude is not supported by UntaggedLeaves", ErrInvalidLeavesOptions)
+		}
+		if q, err = applyLeavesOptions(q, join, o); err != nil {
+			return err
+		}
 	}
-	err = isLeaveSlice(target)
+	return q.Preload(join.fieldName).Find(target).Error
+}
+
+const untaggedLeavesQuery = `%s.%s NOT IN (SELECT j.%s FROM %s j
+JOIN %s n ON n.node_id = j.%s
+WHERE n.tenant = ?)`
+
+// LeafCounts returns, for parentID and each of its descendants up to maxDepth, the number of
+// distinct leaves of type leafModel, e.g. Book{}, attached to the node or to any of its
+// descendants. With directOnly only the leaves attached to the node itself are counted.
+// Nodes without leaves are included with a count of 0; the root parentID (0) covers all nodes of the tenant.
+func (ct *TreeOf[K]) LeafCounts(ctx context.Context, leafModel any, parentID K, maxDepth int, tenant string,
+	directOnly bool) (map[K]int, error) {
+	tenant, err := validateTenant(tenant)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	stmt := &gorm.Statement{DB: ct.db}
-	err = stmt.Parse(target)
+	join, err := ct.resolveLeafJoin(leafModel)
 	if err != nil {
-		return fmt.Errorf("error parsing schema: %w", err)
+		return nil, err
 	}
-	leaveTblName := stmt.Schema.Table
-
-	fieldName, m2mTbl, err := getGormM2MTblName(target)
+	ids, err := ct.DescendantIds(ctx, parentID, maxDepth, tenant)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := validateTableName(m2mTbl); err != nil {
-		return err
+	if !isRoot(parentID) {
+		ids = append(ids, parentID)
 	}
-	if err := validateTableName(leaveTblName); err != nil {
-		return err
+	counts := make(map[K]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	for _, id := range ids {
+		counts[id] = 0
 	}
 
-	joinSql := fmt.Sprintf(leavesJoinQuery, m2mTbl, leaveTblName, leafIDDBField, m2mTbl, singular(leaveTblName), leafIDDBField)
-	err = ct.db.WithContext(ctx).Model(target).InnerJoins(joinSql).
-		Preload(fieldName).
-		Where(fmt.Sprintf(leavesWhereQuery, m2mTbl, singular(ct.nodesTbl), nodeIdDBField, leaveTblName), ids, tenant).
-		Distinct().
-		Find(target).Error
+	var q *gorm.DB
+	if directOnly {
+		q = ct.db.WithContext(ctx).Raw(fmt.Sprintf(leafCountsDirectQuery, join.nodeCol, join.leafCol, join.joinTbl,
+			join.leafTbl, leafIDDBField, join.leafCol, leafTenantDBField, join.nodeCol, join.nodeCol), tenant, ids)
+	} else {
+		q = ct.db.WithContext(ctx).Raw(fmt.Sprintf(leafCountsQuery, join.leafCol, ct.relationsTbl, join.joinTbl,
+			join.nodeCol, join.leafTbl, leafIDDBField, join.leafCol, leafTenantDBField), tenant, tenant, ids)
+	}
+	var rows []struct {
+		NodeID    K
+		LeafCount int
+	}
+	if err := q.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("LeafCounts: %w", err)
+	}
+	for _, r := range rows {
+		counts[r.NodeID] = r.LeafCount
+	}
+	return counts, nil
+}
 
-	return err
+// leafCountsQuery counts the distinct leaves attached to the subtree of every passed node.
+const leafCountsQuery = `SELECT r.ancestor_id AS node_id, COUNT(DISTINCT j.%s) AS leaf_count
+FROM %s r
+JOIN %s j ON j.%s = r.descendant_id
+JOIN %s l ON l.%s = j.%s AND l.%s = ?
+WHERE r.tenant = ? AND r.ancestor_id IN ?
+GROUP BY r.ancestor_id`
+
+// leafCountsDirectQuery counts the distinct leaves attached to every passed node.
+const leafCountsDirectQuery = `SELECT j.%s AS node_id, COUNT(DISTINCT j.%s) AS leaf_count
+FROM %s j
+JOIN %s l ON l.%s = j.%s AND l.%s = ?
+WHERE j.%s IN ?
+GROUP BY j.%s`
+
+// LeafNodeRefOf is a node that applies to a leaf, either because the leaf is attached to it or
+// because it is an ancestor of such a node.
+type LeafNodeRefOf[K ID] struct {
+	NodeID K
+	// Direct is true if the leaf is attached to the node itself.
+	Direct bool
+	// Depth is the distance to the nearest node the leaf is attached to, 0 for direct nodes.
+	Depth int
 }
 
-const leavesJoinQuery = `INNER JOIN %s ON %s.%s = %s.%s_%s`
-const leavesWhereQuery = `%s.%s_%s IN ? AND %s.tenant = ?`
+// LeafNodeRef is the LeafNodeRefOf of trees with uint IDs.
+type LeafNodeRef = LeafNodeRefOf[uint]
 
-// singular returns the singular form of the input string using proper English inflection rules.
-func singular(in string) string {
-	return inflection.Singular(in)
+// NodesForLeaf returns the nodes the leaf leafID of type leafModel, e.g. Book{}, is attached to
+// together with all their ancestors, ordered by depth and node ID. If items is not nil, it must be
+// a pointer to a slice of tree items and is populated with the same nodes in the same order.
+// It returns ErrLeafNotFound if the leaf does not exist in tenant.
+func (ct *TreeOf[K]) NodesForLeaf(ctx context.Context, leafModel any, leafID uint, tenant string, items any) ([]LeafNodeRefOf[K], error) {
+	tenant, err := validateTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	join, err := ct.resolveLeafJoin(leafModel)
+	if err != nil {
+		return nil, err
+	}
+	db := ct.db.WithContext(ctx)
+	if err := ct.checkLeafIDs(db, join, []uint{leafID}, tenant); err != nil {
+		return nil, err
+	}
+
+	refsSql := fmt.Sprintf(leafNodesQuery, join.joinTbl, ct.relationsTbl, join.nodeCol, join.leafCol)
+	var root K
+	refs := []LeafNodeRefOf[K]{}
+	if err := db.Raw(refsSql+" ORDER BY depth, node_id", tenant, leafID, root).Scan(&refs).Error; err != nil {
+		return nil, fmt.Errorf("NodesForLeaf: %w", err)
+	}
+	for i := range refs {
+		refs[i].Direct = refs[i].Depth == 0
+	}
+	if items == nil {
+		return refs, nil
+	}
+	itemsSql := fmt.Sprintf(leafNodeItemsQuery, ct.nodesTbl, refsSql, ct.relationsTbl)
+	if ct.opts.StoreParentID {
+		itemsSql = fmt.Sprintf(leafNodeItemsStoredParentQuery, ct.nodesTbl, refsSql)
+	}
+	if err := db.Raw(itemsSql, tenant, leafID, root, tenant).Scan(items).Error; err != nil {
+		return nil, fmt.Errorf("NodesForLeaf: failed to load nodes: %w", err)
+	}
+	return refs, nil
 }
+
+// leafNodesQuery selects the nodes a leaf is attached to and their ancestors, with the distance
+// to the nearest attached node; the root sentinel is excluded.
+const leafNodesQuery = `SELECT r.ancestor_id AS node_id, MIN(r.depth) AS depth
+FROM %s j
+JOIN %s r ON r.descendant_id = j.%s AND r.tenant = ?
+WHERE j.%s = ? AND r.ancestor_id <> ?
+GROUP BY r.ancestor_id`
+
+const leafNodeItemsQuery = `SELECT nodes.*, parent_rel.ancestor_id AS parent_id
+FROM %s AS nodes
+JOIN (%s) AS refs ON refs.node_id = nodes.node_id
+LEFT JOIN %s AS parent_rel
+  ON parent_rel.descendant_id = nodes.node_id
+  AND parent_rel.depth = 1
+  AND parent_rel.tenant = nodes.tenant
+WHERE nodes.tenant = ?
+ORDER BY refs.depth, nodes.node_id`
+
+const leafNodeItemsStoredParentQuery = `SELECT nodes.*
+FROM %s AS nodes
+JOIN (%s) AS refs ON refs.node_id = nodes.node_id
+WHERE nodes.tenant = ?
+ORDER BY refs.depth, nodes.node_id`
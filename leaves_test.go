@@ -0,0 +1,492 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/gorm"
+)
+
+// setupLeavesTree populates the tree, registers TestLeaf and attaches the leaves to the given nodes,
+// leaves are created in order so their IDs follow the slice order.
+func setupLeavesTree(t *testing.T, db testdbs.TargetDb, opts closuretree.Options, leaves []TestLeaf, nodes [][]uint) (*closuretree.Tree, *gorm.DB) {
+	t.Helper()
+	gdb := connAndClose(t, db)
+	gdb.Exec("DROP TABLE IF EXISTS test_leaf_nodes")
+	gdb.Exec("DROP TABLE IF EXISTS test_leafs")
+	dropTreeTables(gdb, TestPayload{})
+	ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	populateTree(t, ct)
+	if err := gdb.AutoMigrate(&TestLeaf{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ct.RegisterLeaves(TestLeaf{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range leaves {
+		if err := gdb.Create(&leaves[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := ct.SetLeafNodes(context.Background(), TestLeaf{}, leaves[i].Id(), nodes[i], leaves[i].Tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ct, gdb
+}
+
+func leafNames(leaves []TestLeaf) []string {
+	names := []string{}
+	for _, l := range leaves {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+func TestGetLeavesOptions(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			var leaves []TestLeaf
+			var nodes [][]uint
+			for i, name := range []string{"d", "b", "e", "a", "c"} {
+				leaves = append(leaves, TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: name})
+				// attach every leaf twice below Electronics to verify DISTINCT
+				nodes = append(nodes, []uint{2, uint(4 + i%2*2)})
+			}
+			ct, _ := setupLeavesTree(t, db, closuretree.Options{}, leaves, nodes)
+			ctx := context.Background()
+			ids := make([]uint, len(leaves))
+			for i := range leaves {
+				ids[i] = leaves[i].Id()
+			}
+
+			tcs := []struct {
+				name    string
+				opts    closuretree.LeavesOptions
+				want    []string
+				wantErr error
+			}{
+				{name: "order by id", opts: closuretree.LeavesOptions{}, want: []string{"d", "b", "e", "a", "c"}},
+				{name: "order by name", opts: closuretree.LeavesOptions{OrderBy: "name"}, want: []string{"a", "b", "c", "d", "e"}},
+				{name: "order by field name desc", opts: closuretree.LeavesOptions{OrderBy: "Name", Desc: true}, want: []string{"e", "d", "c", "b", "a"}},
+				{name: "limit and offset", opts: closuretree.LeavesOptions{OrderBy: "name", Limit: 2, Offset: 1}, want: []string{"b", "c"}},
+				{name: "keyset", opts: closuretree.LeavesOptions{AfterLeafID: ids[1], Limit: 2}, want: []string{"e", "a"}},
+				{name: "keyset desc", opts: closuretree.LeavesOptions{AfterLeafID: ids[3], Desc: true}, want: []string{"e", "b", "d"}},
+				{name: "unknown column", opts: closuretree.LeavesOptions{OrderBy: "name; DROP TABLE x"}, wantErr: closuretree.ErrInvalidLeavesOptions},
+				{name: "keyset with custom order", opts: closuretree.LeavesOptions{OrderBy: "name", AfterLeafID: 1}, wantErr: closuretree.ErrInvalidLeavesOptions},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					var got []TestLeaf
+					err := ct.GetLeaves(ctx, &got, 1, 0, tenant1, tc.opts)
+					if tc.wantErr != nil {
+						if !errors.Is(err, tc.wantErr) {
+							t.Errorf("expected %v, got %v", tc.wantErr, err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if diff := cmp.Diff(leafNames(got), tc.want); diff != "" {
+						t.Errorf("unexpected leaves (-got +want):\n%s", diff)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestCountLeaves(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			leaves := []TestLeaf{
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone book"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "laptop book"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "shirt book"},
+				{Leaf: closuretree.Leaf{Tenant: tenant2}, Name: "red book"},
+			}
+			ct, _ := setupLeavesTree(t, db, closuretree.Options{}, leaves, [][]uint{{2, 6}, {4}, {5}, {12}})
+			ctx := context.Background()
+
+			tcs := []struct {
+				parent   uint
+				maxDepth int
+				tenant   string
+				want     int64
+			}{
+				{parent: 1, tenant: tenant1, want: 2},
+				{parent: 1, maxDepth: 1, tenant: tenant1, want: 2},
+				{parent: 2, tenant: tenant1, want: 1},
+				{parent: 0, tenant: tenant1, want: 3},
+				{parent: 7, tenant: tenant2, want: 1},
+				{parent: 1, tenant: tenant2, want: 0},
+			}
+			for _, tc := range tcs {
+				t.Run(fmt.Sprintf("%s/%d/%d", tc.tenant, tc.parent, tc.maxDepth), func(t *testing.T) {
+					got, err := ct.CountLeaves(ctx, TestLeaf{}, tc.parent, tc.maxDepth, tc.tenant)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got != tc.want {
+						t.Errorf("expected %d leaves, got %d", tc.want, got)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestLeafCounts(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			leaves := []TestLeaf{
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "laptop"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone shirt"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "shirt"},
+				{Leaf: closuretree.Leaf{Tenant: tenant2}, Name: "red"},
+			}
+			ct, _ := setupLeavesTree(t, db, closuretree.Options{}, leaves, [][]uint{{4}, {6}, {2, 5}, {5}, {12}})
+			ctx := context.Background()
+
+			tcs := []struct {
+				name       string
+				parent     uint
+				maxDepth   int
+				tenant     string
+				directOnly bool
+				want       map[uint]int
+			}{
+				{name: "rolled up", tenant: tenant1, want: map[uint]int{1: 3, 2: 2, 3: 2, 4: 1, 5: 2, 6: 1}},
+				{name: "direct only", tenant: tenant1, directOnly: true, want: map[uint]int{1: 0, 2: 1, 3: 0, 4: 1, 5: 2, 6: 1}},
+				{name: "subtree with depth", parent: 1, maxDepth: 1, tenant: tenant1, want: map[uint]int{1: 3, 2: 2, 4: 1}},
+				{name: "other tenant", parent: 8, tenant: tenant2, want: map[uint]int{8: 1, 12: 1, 13: 0}},
+				{name: "unknown parent", parent: 999, tenant: tenant1, want: map[uint]int{999: 0}},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					got, err := ct.LeafCounts(ctx, TestLeaf{}, tc.parent, tc.maxDepth, tc.tenant, tc.directOnly)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if diff := cmp.Diff(got, tc.want); diff != "" {
+						t.Errorf("unexpected counts (-got +want):\n%s", diff)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestNodesForLeaf(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			leaves := []TestLeaf{
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone shirt"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "touch"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "untagged"},
+			}
+			ct, _ := setupLeavesTree(t, db, closuretree.Options{}, leaves, [][]uint{{2, 5}, {6, 2}, nil})
+			ctx := context.Background()
+
+			var items []TestPayload
+			got, err := ct.NodesForLeaf(ctx, TestLeaf{}, leaves[0].Id(), tenant1, &items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []closuretree.LeafNodeRef{
+				{NodeID: 2, Direct: true, Depth: 0},
+				{NodeID: 5, Direct: true, Depth: 0},
+				{NodeID: 1, Direct: false, Depth: 1},
+				{NodeID: 3, Direct: false, Depth: 1},
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("unexpected nodes (-got +want):\n%s", diff)
+			}
+			var names []string
+			var parents []uint
+			for _, item := range items {
+				names = append(names, item.Name)
+				parents = append(parents, item.ParentId)
+			}
+			if diff := cmp.Diff(names, []string{"Mobile Phones", "T-Shirt", "Electronics", "Clothing"}); diff != "" {
+				t.Errorf("unexpected items (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(parents, []uint{1, 3, 0, 0}); diff != "" {
+				t.Errorf("unexpected item parents (-got +want):\n%s", diff)
+			}
+
+			// attached to a node and to its ancestor: the ancestor is direct
+			got, err = ct.NodesForLeaf(ctx, TestLeaf{}, leaves[1].Id(), tenant1, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = []closuretree.LeafNodeRef{
+				{NodeID: 2, Direct: true, Depth: 0},
+				{NodeID: 6, Direct: true, Depth: 0},
+				{NodeID: 1, Direct: false, Depth: 1},
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("unexpected nodes (-got +want):\n%s", diff)
+			}
+
+			got, err = ct.NodesForLeaf(ctx, TestLeaf{}, leaves[2].Id(), tenant1, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 0 {
+				t.Errorf("expected no nodes for an untagged leaf, got %v", got)
+			}
+
+			_, err = ct.NodesForLeaf(ctx, TestLeaf{}, leaves[0].Id(), tenant2, nil)
+			if !errors.Is(err, closuretree.ErrLeafNotFound) {
+				t.Errorf("expected ErrLeafNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// CustomColLeaf names its join columns with joinForeignKey and joinReferences.
+type CustomColLeaf struct {
+	closuretree.Leaf
+	Name  string
+	Nodes []TestPayload `gorm:"many2many:custom_col_leaf_nodes;joinForeignKey:BookRef;joinReferences:TagRef"`
+}
+
+// JoinModelLeaf uses JoinModelLeafNode as join model, set up with gorm.DB.SetupJoinTable.
+type JoinModelLeaf struct {
+	closuretree.Leaf
+	Name  string
+	Nodes []TestPayload `gorm:"many2many:join_model_leaf_nodes"`
+}
+
+type JoinModelLeafNode struct {
+	JoinModelLeafLeafID uint `gorm:"primaryKey"`
+	TestPayloadNodeID   uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+}
+
+func TestLeafJoinSchema(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			for _, tbl := range []string{"custom_col_leaf_nodes", "custom_col_leafs", "join_model_leaf_nodes", "join_model_leafs"} {
+				gdb.Exec("DROP TABLE IF EXISTS " + tbl)
+			}
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+			if err := gdb.SetupJoinTable(&JoinModelLeaf{}, "Nodes", &JoinModelLeafNode{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.AutoMigrate(&CustomColLeaf{}, &JoinModelLeaf{}); err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			tcs := []struct {
+				name     string
+				leaf     interface{ Id() uint }
+				joinTbl  string
+				leafCol  string
+				nodeCol  string
+				newSlice func() any
+			}{
+				{
+					name: "join column tags", leaf: &CustomColLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "custom"},
+					joinTbl: "custom_col_leaf_nodes", leafCol: "book_ref", nodeCol: "tag_ref",
+					newSlice: func() any { return &[]CustomColLeaf{} },
+				},
+				{
+					name: "join model", leaf: &JoinModelLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "model"},
+					joinTbl: "join_model_leaf_nodes", leafCol: "join_model_leaf_leaf_id", nodeCol: "test_payload_node_id",
+					newSlice: func() any { return &[]JoinModelLeaf{} },
+				},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					if err := gdb.Create(tc.leaf).Error; err != nil {
+						t.Fatal(err)
+					}
+					if err := ct.AttachLeaf(ctx, tc.leaf, tc.leaf.Id(), 6, tenant1); err != nil {
+						t.Fatal(err)
+					}
+					var rows int64
+					err := gdb.Table(tc.joinTbl).Where(tc.leafCol+" = ? AND "+tc.nodeCol+" = ?", tc.leaf.Id(), 6).Count(&rows).Error
+					if err != nil {
+						t.Fatal(err)
+					}
+					if rows != 1 {
+						t.Errorf("expected 1 join row in %s, got %d", tc.joinTbl, rows)
+					}
+
+					got := tc.newSlice()
+					if err := ct.GetLeaves(ctx, got, 1, 0, tenant1); err != nil {
+						t.Fatal(err)
+					}
+					if n := reflect.ValueOf(got).Elem().Len(); n != 1 {
+						t.Errorf("expected 1 leaf, got %d", n)
+					}
+					count, err := ct.CountLeaves(ctx, tc.leaf, 2, 0, tenant1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if count != 1 {
+						t.Errorf("expected count 1, got %d", count)
+					}
+				})
+			}
+		})
+	}
+}
+
+// Edition is the target of a second many2many relation of MultiRelationBook, e.g. the nodes of another tree.
+type Edition struct {
+	ID   uint
+	Name string
+}
+
+// BookBase embeds Leaf one level below the leaf struct.
+type BookBase struct {
+	closuretree.Leaf
+	Name string
+}
+
+// MultiRelationBook has many2many relations to the tree nodes and to Edition.
+type MultiRelationBook struct {
+	BookBase
+	Editions []Edition     `gorm:"many2many:multi_relation_book_editions"`
+	Tags     []TestPayload `gorm:"many2many:multi_relation_book_tags"`
+}
+
+func TestLeavesMultipleRelations(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			for _, tbl := range []string{"multi_relation_book_tags", "multi_relation_book_editions", "multi_relation_books", "editions"} {
+				gdb.Exec("DROP TABLE IF EXISTS " + tbl)
+			}
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+			if err := gdb.AutoMigrate(&MultiRelationBook{}); err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			book := &MultiRelationBook{
+				BookBase: BookBase{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "book"},
+				Editions: []Edition{{Name: "Paperback"}},
+			}
+			if err := gdb.Create(book).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.AttachLeaf(ctx, &MultiRelationBook{}, book.Id(), 2, tenant1); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []*MultiRelationBook
+			if err := ct.GetLeaves(ctx, &got, 1, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || len(got[0].Tags) != 1 || got[0].Tags[0].Name != "Mobile Phones" {
+				t.Errorf("expected the book with its tag, got %+v", got)
+			}
+			var rows int64
+			if err := gdb.Table("multi_relation_book_editions").Count(&rows).Error; err != nil {
+				t.Fatal(err)
+			}
+			if rows != 1 {
+				t.Errorf("expected the genre relation to be untouched, got %d rows", rows)
+			}
+
+			type noTreeRelation struct {
+				closuretree.Leaf
+				Editions []Edition `gorm:"many2many:no_tree_relation_editions"`
+			}
+			var none []noTreeRelation
+			if err := ct.GetLeaves(ctx, &none, 1, 0, tenant1); err == nil {
+				t.Error("expected an error for a leaf without a relation to the tree")
+			}
+		})
+	}
+}
+
+func TestUntaggedAndExcludedLeaves(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			leaves := []TestLeaf{
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "laptop"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "none"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "phone"},
+				{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "shirt"},
+				{Leaf: closuretree.Leaf{Tenant: tenant2}, Name: "red"},
+			}
+			ct, _ := setupLeavesTree(t, db, closuretree.Options{}, leaves, [][]uint{{4}, nil, {6}, {5}, {12}})
+			ctx := context.Background()
+			byName := closuretree.LeavesOptions{OrderBy: "name"}
+
+			excludeTcs := []struct {
+				name     string
+				parent   uint
+				maxDepth int
+				want     []string
+			}{
+				{name: "outside subtree", parent: 1, want: []string{"none", "shirt"}},
+				{name: "outside nested subtree", parent: 2, want: []string{"laptop", "none", "shirt"}},
+				{name: "outside subtree with depth", parent: 1, maxDepth: 1, want: []string{"none", "phone", "shirt"}},
+				{name: "outside every node", parent: 0, want: []string{"none"}},
+			}
+			for _, tc := range excludeTcs {
+				t.Run(tc.name, func(t *testing.T) {
+					var got []TestLeaf
+					err := ct.GetLeaves(ctx, &got, tc.parent, tc.maxDepth, tenant1, byName, closuretree.LeavesOptions{Exclude: true})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if diff := cmp.Diff(leafNames(got), tc.want); diff != "" {
+						t.Errorf("unexpected leaves (-got +want):\n%s", diff)
+					}
+				})
+			}
+
+			t.Run("untagged", func(t *testing.T) {
+				var got []TestLeaf
+				if err := ct.UntaggedLeaves(ctx, &got, tenant1, byName); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(leafNames(got), []string{"none"}); diff != "" {
+					t.Errorf("unexpected leaves (-got +want):\n%s", diff)
+				}
+
+				// the join row of shirt is left pointing at the deleted node
+				if err := ct.DeleteRecurse(ctx, 5, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				got = nil
+				if err := ct.UntaggedLeaves(ctx, &got, tenant1, byName); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(leafNames(got), []string{"none", "shirt"}); diff != "" {
+					t.Errorf("unexpected leaves after delete (-got +want):\n%s", diff)
+				}
+			})
+		})
+	}
+}
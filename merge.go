@@ -0,0 +1,274 @@
+package closuretree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Merge merges the node sourceID into targetID: the direct children of the source are moved under the
+// target, after its existing children and keeping their relative order, the join rows of the leaf
+// models registered with RegisterLeaves are repointed from source to target without duplicates, and
+// the source node is deleted. All of it runs in a single transaction.
+//
+// The move hooks are called for every moved child and the delete hooks for the source.
+// It returns ErrInvalidMove if source and target are the same node or the target is a descendant of the source,
+// and ErrUnregisteredLeaves if a table not registered with RegisterLeaves has a foreign key to the
+// nodes table with rows referencing the source, since those rows could not be repointed.
+func (ct *TreeOf[K]) Merge(ctx context.Context, sourceID, targetID K, tenant string) error {
+	var err error
+	tenant, err = validateTenant(tenant)
+	if err != nil {
+		return err
+	}
+	if sourceID == targetID {
+		return fmt.Errorf("%w: cannot merge a node into itself", ErrInvalidMove)
+	}
+	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ct.lockSiblingsInTx(tx, targetID, tenant); err != nil {
+			return err
+		}
+		if err := ct.validateMerge(tx, sourceID, targetID, tenant); err != nil {
+			return err
+		}
+		if err := ct.checkUnregisteredLeavesInTx(tx, sourceID); err != nil {
+			return err
+		}
+		children, err := ct.childIDsInTx(tx, sourceID, tenant)
+		if err != nil {
+			return err
+		}
+		lastChild, err := ct.lastChildIDInTx(tx, targetID, tenant)
+		if err != nil {
+			return err
+		}
+
+		hooks := ct.hookTargets(nil)
+		var events []ChangeEventOf[K]
+		for _, child := range children {
+			event := HookEventOf[K]{Tx: tx, Tenant: tenant, NodeID: child, OldParentID: sourceID, NewParentID: targetID, AfterNodeID: lastChild}
+			moveEvents, err := ct.mergeChildInTx(ctx, tx, hooks, event)
+			if err != nil {
+				return err
+			}
+			events = append(events, moveEvents...)
+			lastChild = child
+		}
+
+		if err := ct.mergeLeavesInTx(tx, sourceID, targetID); err != nil {
+			return err
+		}
+		return ct.mergeDeleteSourceInTx(ctx, tx, hooks, sourceID, tenant, events)
+	})
+}
+
+// validateMerge checks that both nodes exist and that the target is not inside the subtree of the source.
+func (ct *TreeOf[K]) validateMerge(tx *gorm.DB, sourceID, targetID K, tenant string) error {
+	var count int64
+	err := tx.Table(ct.nodesTbl).Where("node_id IN ? AND tenant = ?", []K{sourceID, targetID}, tenant).Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("merge: unable to check nodes: %w", err)
+	}
+	if count != 2 {
+		return ErrNodeNotFound
+	}
+	err = tx.Table(ct.relationsTbl).
+		Where("ancestor_id = ? AND descendant_id = ? AND tenant = ?", sourceID, targetID, tenant).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("merge: unable to check ancestry: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: target %v is a descendant of source %v", ErrInvalidMove, targetID, sourceID)
+	}
+	return nil
+}
+
+// ErrUnregisteredLeaves is returned by Merge when the source node is referenced by a table whose
+// leaf model is not registered with RegisterLeaves.
+var ErrUnregisteredLeaves = errors.New("node is referenced by an unregistered leaf table")
+
+// nodeReference is a column of another table with a foreign key to the nodes table.
+type nodeReference struct {
+	Tbl string
+	Col string
+}
+
+// nodeReferencesQueries list the foreign keys referencing a table, by dialect. The sqlite query
+// takes the table name, the others the schema and the table name.
+var nodeReferencesQueries = map[string]string{
+	dialectSqlite: `SELECT m.name AS tbl, f."from" AS col
+FROM sqlite_master m JOIN pragma_foreign_key_list(m.name) f
+WHERE m.type = 'table' AND f."table" = ?`,
+	dialectPostgres: `SELECT kcu.table_schema || '.' || kcu.table_name AS tbl, kcu.column_name AS col
+FROM information_schema.table_constraints tc
+JOIN information_schema.key_column_usage kcu
+  ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name
+JOIN information_schema.constraint_column_usage ccu
+  ON ccu.constraint_schema = tc.constraint_schema AND ccu.constraint_name = tc.constraint_name
+WHERE tc.constraint_type = 'FOREIGN KEY' AND ccu.table_schema = COALESCE(?, current_schema()) AND ccu.table_name = ?`,
+	dialectMysql: `SELECT table_name AS tbl, column_name AS col
+FROM information_schema.key_column_usage
+WHERE referenced_table_schema = COALESCE(?, DATABASE()) AND referenced_table_name = ?`,
+}
+
+// checkUnregisteredLeavesInTx returns ErrUnregisteredLeaves if a table other than the join tables
+// of the registered leaves has a foreign key to the nodes table and rows referencing sourceID.
+// Tables without a foreign key, and dialects other than sqlite, postgres and mysql, are not checked.
+func (ct *TreeOf[K]) checkUnregisteredLeavesInTx(tx *gorm.DB, sourceID K) error {
+	query, ok := nodeReferencesQueries[tx.Name()]
+	if !ok {
+		return nil
+	}
+	schemaName, table := splitTableName(ct.nodesTbl)
+	args := []any{table}
+	if tx.Name() != dialectSqlite {
+		var qualifier *string
+		if schemaName != "" {
+			qualifier = &schemaName
+		}
+		args = []any{qualifier, table}
+	}
+	var refs []nodeReference
+	if err := tx.Raw(query, args...).Scan(&refs).Error; err != nil {
+		return fmt.Errorf("merge: unable to list the tables referencing %s: %w", ct.nodesTbl, err)
+	}
+
+	registered := map[string]bool{}
+	for _, join := range ct.leaves {
+		_, joinTbl := splitTableName(join.joinTbl)
+		registered[joinTbl] = true
+	}
+	for _, ref := range refs {
+		if _, refTbl := splitTableName(ref.Tbl); registered[refTbl] {
+			continue
+		}
+		var count int64
+		if err := tx.Table(ref.Tbl).Where(fmt.Sprintf("%s = ?", ref.Col), sourceID).Count(&count).Error; err != nil {
+			return fmt.Errorf("merge: unable to check %s: %w", ref.Tbl, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s.%s references node %v, register its leaf model with RegisterLeaves",
+				ErrUnregisteredLeaves, ref.Tbl, ref.Col, sourceID)
+		}
+	}
+	return nil
+}
+
+// childIDsInTx returns the direct children of parentID in display order.
+func (ct *TreeOf[K]) childIDsInTx(tx *gorm.DB, parentID K, tenant string) ([]K, error) {
+	var ids []K
+	err := tx.Raw(fmt.Sprintf(`SELECT n.node_id FROM %s n
+JOIN %s r ON r.descendant_id = n.node_id AND r.tenant = n.tenant
+WHERE r.ancestor_id = ? AND r.depth = 1 AND n.tenant = ?
+ORDER BY n.sort_order ASC, n.node_id ASC`, ct.nodesTbl, ct.relationsTbl), parentID, tenant).
+		Scan(&ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("unable to load children of %v: %w", parentID, err)
+	}
+	return ids, nil
+}
+
+// lastChildIDInTx returns the last direct child of parentID in display order, the zero value if
+// it has none.
+func (ct *TreeOf[K]) lastChildIDInTx(tx *gorm.DB, parentID K, tenant string) (K, error) {
+	children, err := ct.childIDsInTx(tx, parentID, tenant)
+	if err != nil || len(children) == 0 {
+		var none K
+		return none, err
+	}
+	return children[len(children)-1], nil
+}
+
+// mergeChildInTx moves a child of the merged source after the sibling e.AfterNodeID of the target,
+// and returns its move event if changes are tracked.
+func (ct *TreeOf[K]) mergeChildInTx(ctx context.Context, tx *gorm.DB, hooks []any, e HookEventOf[K]) ([]ChangeEventOf[K], error) {
+	if err := callHooks(hooks, "BeforeMove", func(h BeforeMoveHookOf[K]) error { return h.BeforeMove(ctx, e) }); err != nil {
+		return nil, err
+	}
+	oldPos, err := ct.sortOrderInTx(tx, e.NodeID, e.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := ct.moveInTx(tx, e.NodeID, e.NewParentID, e.Tenant); err != nil {
+		return nil, err
+	}
+	if err := ct.reorderInTx(tx, e.NodeID, e.AfterNodeID, &e.NewParentID, e.Tenant); err != nil {
+		return nil, err
+	}
+	if err := ct.enforceConstraints(tx, e.NodeID, e.Tenant, true); err != nil {
+		return nil, err
+	}
+	if err := callHooks(hooks, "AfterMove", func(h AfterMoveHookOf[K]) error { return h.AfterMove(ctx, e) }); err != nil {
+		return nil, err
+	}
+	if !ct.tracksChanges() {
+		return nil, nil
+	}
+	return ct.updateEvents(tx, e, false, true, false, oldPos)
+}
+
+// mergeLeavesInTx repoints the join rows of registered leaves from sourceID to targetID, dropping
+// the rows of leaves that are already attached to the target.
+func (ct *TreeOf[K]) mergeLeavesInTx(tx *gorm.DB, sourceID, targetID K) error {
+	for _, join := range ct.leaves {
+		var onTarget []uint
+		err := tx.Table(join.joinTbl).Where(fmt.Sprintf("%s = ?", join.nodeCol), targetID).
+			Pluck(join.leafCol, &onTarget).Error
+		if err != nil {
+			return fmt.Errorf("merge: unable to load leaves of target: %w", err)
+		}
+		if len(onTarget) > 0 {
+			err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = ? AND %s IN ?`, join.joinTbl, join.nodeCol, join.leafCol),
+				sourceID, onTarget).Error
+			if err != nil {
+				return fmt.Errorf("merge: unable to drop duplicate leaves: %w", err)
+			}
+		}
+		err = tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, join.joinTbl, join.nodeCol, join.nodeCol),
+			targetID, sourceID).Error
+		if err != nil {
+			return fmt.Errorf("merge: unable to repoint leaves: %w", err)
+		}
+	}
+	return nil
+}
+
+// mergeDeleteSourceInTx deletes the now childless source node and records the events of the merge.
+func (ct *TreeOf[K]) mergeDeleteSourceInTx(ctx context.Context, tx *gorm.DB, hooks []any, sourceID K, tenant string,
+	events []ChangeEventOf[K]) error {
+	event := HookEventOf[K]{Tx: tx, Tenant: tenant, NodeID: sourceID, DeletedIDs: []K{sourceID}}
+	if err := callHooks(hooks, "BeforeDelete", func(h BeforeDeleteHookOf[K]) error { return h.BeforeDelete(ctx, event) }); err != nil {
+		return err
+	}
+	var snaps payloadSnapshots[K]
+	if ct.tracksChanges() {
+		deleteEvents, err := ct.deleteEvents(tx, sourceID, tenant)
+		if err != nil {
+			return err
+		}
+		events = append(events, deleteEvents...)
+		if snaps.before, err = ct.snapshotPayloads(tx, tenant, sourceID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ? AND (descendant_id = ? OR ancestor_id = ?)`, ct.relationsTbl),
+		tenant, sourceID, sourceID).Error; err != nil {
+		return fmt.Errorf("merge: failed to delete closure rows of source: %w", err)
+	}
+	if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ? AND node_id = ?`, ct.nodesTbl),
+		tenant, sourceID).Error; err != nil {
+		return fmt.Errorf("merge: failed to delete source: %w", err)
+	}
+	if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ? AND parent_id = ?`, ct.metaTbl),
+		tenant, sourceID).Error; err != nil {
+		return fmt.Errorf("merge: failed to clean metadata of source: %w", err)
+	}
+	if err := ct.recordChanges(ctx, tx, events, snaps); err != nil {
+		return err
+	}
+	return callHooks(hooks, "AfterDelete", func(h AfterDeleteHookOf[K]) error { return h.AfterDelete(ctx, event) })
+}
@@ -0,0 +1,168 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMerge(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			gdb.Exec("DROP TABLE IF EXISTS test_leaf_nodes")
+			gdb.Exec("DROP TABLE IF EXISTS test_leafs")
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+			if err := gdb.AutoMigrate(&TestLeaf{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.RegisterLeaves(TestLeaf{}); err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			// "both" is attached to source and target, "source" only to the source
+			both := &TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "both"}
+			onlySource := &TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "source"}
+			for _, leaf := range []*TestLeaf{both, onlySource} {
+				if err := gdb.Create(leaf).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			source, target := &TestPayload{}, &TestPayload{}
+			source.NodeId, target.NodeId = 1, 3
+			if err := gdb.Model(both).Association("Nodes").Append(source, target); err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.Model(onlySource).Association("Nodes").Append(source); err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("errors", func(t *testing.T) {
+				tcs := []struct {
+					name           string
+					source, target uint
+					wantErr        error
+				}{
+					{name: "same node", source: 1, target: 1, wantErr: closuretree.ErrInvalidMove},
+					{name: "target below source", source: 1, target: 6, wantErr: closuretree.ErrInvalidMove},
+					{name: "unknown source", source: 999, target: 3, wantErr: closuretree.ErrNodeNotFound},
+					{name: "target in other tenant", source: 1, target: 7, wantErr: closuretree.ErrNodeNotFound},
+				}
+				for _, tc := range tcs {
+					t.Run(tc.name, func(t *testing.T) {
+						err := ct.Merge(ctx, tc.source, tc.target, tenant1)
+						if !errors.Is(err, tc.wantErr) {
+							t.Errorf("expected %v, got %v", tc.wantErr, err)
+						}
+					})
+				}
+			})
+
+			// Electronics (1) with children Laptops (4) and Mobile Phones (2) merges into Clothing (3)
+			if err := ct.Merge(ctx, 1, 3, tenant1); err != nil {
+				t.Fatal(err)
+			}
+
+			children, err := ct.DescendantIds(ctx, 3, 1, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(children, []uint{5, 4, 2}); diff != "" {
+				t.Errorf("unexpected children of target (-got +want):\n%s", diff)
+			}
+			assertIsDirectChild(t, ct, 2, 6, tenant1)
+			if err := ct.GetNode(ctx, 1, tenant1, &TestPayload{}); !errors.Is(err, closuretree.ErrNodeNotFound) {
+				t.Errorf("expected the source to be deleted, got %v", err)
+			}
+
+			var leaves []TestLeaf
+			if err := ct.GetLeaves(ctx, &leaves, 3, 1, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, l := range leaves {
+				names = append(names, l.Name)
+			}
+			if diff := cmp.Diff(names, []string{"both", "source"}); diff != "" {
+				t.Errorf("unexpected leaves of target (-got +want):\n%s", diff)
+			}
+			var joinRows int64
+			if err := gdb.Table("test_leaf_nodes").Count(&joinRows).Error; err != nil {
+				t.Fatal(err)
+			}
+			if joinRows != 2 {
+				t.Errorf("expected 2 join rows without duplicates, got %d", joinRows)
+			}
+		})
+	}
+}
+
+func TestMergeUnregisteredLeaves(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			ctx := context.Background()
+			tcs := []struct {
+				name     string
+				attachTo uint
+				register bool
+				wantErr  error
+			}{
+				{name: "leaf on source", attachTo: 1, wantErr: closuretree.ErrUnregisteredLeaves},
+				{name: "leaf on target", attachTo: 3},
+				{name: "registered leaf on source", attachTo: 1, register: true},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					gdb.Exec("DROP TABLE IF EXISTS test_leaf_nodes")
+					gdb.Exec("DROP TABLE IF EXISTS test_leafs")
+					dropTreeTables(gdb, TestPayload{})
+					ct, err := closuretree.New(gdb, TestPayload{})
+					if err != nil {
+						t.Fatal(err)
+					}
+					populateTree(t, ct)
+					if err := gdb.AutoMigrate(&TestLeaf{}); err != nil {
+						t.Fatal(err)
+					}
+					if tc.register {
+						if err := ct.RegisterLeaves(TestLeaf{}); err != nil {
+							t.Fatal(err)
+						}
+					}
+					leaf := &TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "leaf"}
+					if err := gdb.Create(leaf).Error; err != nil {
+						t.Fatal(err)
+					}
+					node := &TestPayload{}
+					node.NodeId = tc.attachTo
+					if err := gdb.Model(leaf).Association("Nodes").Append(node); err != nil {
+						t.Fatal(err)
+					}
+
+					err = ct.Merge(ctx, 1, 3, tenant1)
+					if !errors.Is(err, tc.wantErr) {
+						t.Fatalf("expected %v, got %v", tc.wantErr, err)
+					}
+					getErr := ct.GetNode(ctx, 1, tenant1, &TestPayload{})
+					if tc.wantErr != nil && getErr != nil {
+						t.Errorf("expected the failed merge to keep the source, got %v", getErr)
+					}
+					if tc.wantErr == nil && !errors.Is(getErr, closuretree.ErrNodeNotFound) {
+						t.Errorf("expected the source to be deleted, got %v", getErr)
+					}
+				})
+			}
+		})
+	}
+}
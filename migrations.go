@@ -0,0 +1,238 @@
+package closuretree
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schemaMigration is a row of the schema table, one per applied migration step.
+type schemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+// migrationStep is a single, ordered change to the tables owned by the tree. Steps must be
+// idempotent: a step can run again if a previous run failed before its version was recorded.
+type migrationStep[K ID] struct {
+	version int
+	name    string
+	up      func(ct *TreeOf[K], db *gorm.DB) error
+}
+
+// migrationSteps returns every schema change in order, append new steps at the end and never
+// change the version of an existing one.
+func migrationSteps[K ID]() []migrationStep[K] {
+	return []migrationStep[K]{
+		{version: 1, name: "create closure and meta tables", up: migrateBaseTables[K]},
+		{version: 2, name: "drop legacy index idx_desc_ten", up: migrateDropLegacyDescIndex[K]},
+		{version: 3, name: "name indexes after their table", up: migrateIndexNames[K]},
+		{version: 4, name: "name the depth check after its table", up: migrateDepthCheckName[K]},
+	}
+}
+
+// SchemaVersion is the schema version of the tables created by this version of the package,
+// the version of the last migration step.
+const SchemaVersion = 4
+
+// Migrate brings the tables of the tree up to date: it applies the pending migration steps of
+// the closure and meta tables in order, recording each applied step in the schema table, and
+// runs AutoMigrate on the node table and on the events and history tables when enabled. With
+// Options.StoreParentID the parent_id column is added to the node table and filled.
+//
+// Migrate is called by New and NewWithOptions; it is safe to run again, e.g. out of band
+// before deploying a new version, and to run concurrently, e.g. by several replicas starting
+// at the same time.
+func (ct *TreeOf[K]) Migrate(ctx context.Context) error {
+	db := ct.db.WithContext(ctx)
+	if err := retryOnce(func() error { return db.Table(ct.schemaTbl).AutoMigrate(schemaMigration{}) }); err != nil {
+		return fmt.Errorf("unable to migrate schema table: %w", err)
+	}
+	current, err := ct.schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	for _, step := range migrationSteps[K]() {
+		if step.version <= current {
+			continue
+		}
+		if err := ct.applyMigrationStep(db, step); err != nil {
+			return fmt.Errorf("unable to apply migration %d (%s): %w", step.version, step.name, err)
+		}
+	}
+	// after the steps, so that indexes renamed by a step are not created again
+	if err := retryOnce(func() error { return db.AutoMigrate(ct.nodeModel()) }); err != nil {
+		return fmt.Errorf("unable to migrate node table: %w", err)
+	}
+	return ct.migrateOptionalTables(db)
+}
+
+// applyMigrationStep records the version of step and applies it in a single transaction. The
+// version row is inserted first and acts as a lock: a concurrent Migrate inserting the same
+// version waits for this transaction to end, then skips the step if it was committed.
+// MySQL commits DDL statements implicitly, there the version row is removed if the step fails.
+func (ct *TreeOf[K]) applyMigrationStep(db *gorm.DB, step migrationStep[K]) error {
+	insertSQL := `INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?) ON CONFLICT (version) DO NOTHING`
+	if isMySQLDialect(db) {
+		insertSQL = `INSERT IGNORE INTO %s (version, name, applied_at) VALUES (?, ?, ?)`
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec(fmt.Sprintf(insertSQL, ct.schemaTbl), step.version, step.name, time.Now().UTC())
+		if res.Error != nil {
+			return fmt.Errorf("unable to record the version: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return nil // applied by a concurrent Migrate
+		}
+		return step.up(ct, tx)
+	})
+	if err != nil && isMySQLDialect(db) {
+		db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE version = ?`, ct.schemaTbl), step.version)
+	}
+	return err
+}
+
+// retryOnce runs a migration again if it fails: two concurrent AutoMigrate calls can both find
+// a table or column missing and one of them fails to create it, the second run finds it.
+func retryOnce(migrate func() error) error {
+	if err := migrate(); err == nil {
+		return nil
+	}
+	return migrate()
+}
+
+// CurrentSchemaVersion returns the schema version recorded in the database for the tree,
+// 0 if no migration was applied yet.
+func (ct *TreeOf[K]) CurrentSchemaVersion(ctx context.Context) (int, error) {
+	db := ct.db.WithContext(ctx)
+	if !db.Migrator().HasTable(ct.schemaTbl) {
+		return 0, nil
+	}
+	return ct.schemaVersion(db)
+}
+
+func (ct *TreeOf[K]) schemaVersion(db *gorm.DB) (int, error) {
+	var version *int
+	err := db.Table(ct.schemaTbl).Select("MAX(version)").Row().Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read schema version: %w", err)
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return *version, nil
+}
+
+// migrateOptionalTables creates or updates the tables and columns of the optional features, these
+// depend on the options of the tree and not on the schema version.
+func (ct *TreeOf[K]) migrateOptionalTables(db *gorm.DB) error {
+	if ct.opts.StoreParentID {
+		if err := retryOnce(func() error { return ct.migrateParentIDColumn(db) }); err != nil {
+			return err
+		}
+	}
+	if ct.opts.Events {
+		if err := retryOnce(func() error { return db.Table(ct.eventsTbl).AutoMigrate(ChangeEventOf[K]{}) }); err != nil {
+			return fmt.Errorf("unable to migrate events table: %w", err)
+		}
+	}
+	if ct.opts.History {
+		if err := retryOnce(func() error { return db.Table(ct.historyTbl).AutoMigrate(HistoryEntryOf[K]{}) }); err != nil {
+			return fmt.Errorf("unable to migrate history table: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrateBaseTables[K ID](ct *TreeOf[K], db *gorm.DB) error {
+	if err := db.Table(ct.relationsTbl).AutoMigrate(closureTree[K]{}); err != nil {
+		return fmt.Errorf("closure table: %w", err)
+	}
+	if err := db.Table(ct.metaTbl).AutoMigrate(closureTreeMeta[K]{}); err != nil {
+		return fmt.Errorf("meta table: %w", err)
+	}
+	return nil
+}
+
+// migrateDropLegacyDescIndex drops the (descendant_id, tenant) index of early versions, it is
+// covered by idx_desc_ten_dep.
+func migrateDropLegacyDescIndex[K ID](ct *TreeOf[K], db *gorm.DB) error {
+	m := db.Table(ct.relationsTbl).Migrator()
+	if !m.HasIndex(&closureTree[K]{}, legacyDescIndex) {
+		return nil
+	}
+	return m.DropIndex(&closureTree[K]{}, legacyDescIndex)
+}
+
+const legacyDescIndex = "idx_desc_ten"
+
+// migrateIndexNames renames the indexes of early versions, whose fixed names collide between
+// trees in the same database, to names derived from their table, e.g. idx_<table>_anc_ten_dep.
+// The indexes of the node and history tables are renamed as well, if the tables exist.
+func migrateIndexNames[K ID](ct *TreeOf[K], db *gorm.DB) error {
+	tables := []struct {
+		name    string
+		model   any
+		indexes [][2]string // legacy name, composite key of the index tag
+	}{
+		{name: ct.relationsTbl, model: &closureTree[K]{}, indexes: [][2]string{
+			{"idx_anc_ten_dep", "anc_ten_dep"}, {"idx_desc_ten_dep", "desc_ten_dep"}, {"idx_closure_uniq", "closure_uniq"},
+		}},
+		{name: ct.nodesTbl, model: ct.nodeModel(), indexes: [][2]string{{"idx_node_tenant", "node_tenant"}}},
+		{name: ct.historyTbl, model: &HistoryEntryOf[K]{}, indexes: [][2]string{{"idx_hist_ten_node", "hist_ten_node"}}},
+	}
+	for _, tbl := range tables {
+		if !db.Migrator().HasTable(tbl.name) {
+			continue
+		}
+		m := db.Table(tbl.name).Migrator()
+		for _, idx := range tbl.indexes {
+			legacy, name := idx[0], db.NamingStrategy.IndexName(tbl.name, idx[1])
+			if !m.HasIndex(tbl.model, legacy) {
+				continue
+			}
+			if m.HasIndex(tbl.model, name) {
+				if err := m.DropIndex(tbl.model, qualifiedIndexName(db, tbl.name, legacy)); err != nil {
+					return fmt.Errorf("unable to drop index %s: %w", legacy, err)
+				}
+				continue
+			}
+			if err := m.RenameIndex(tbl.model, qualifiedIndexName(db, tbl.name, legacy), name); err != nil {
+				return fmt.Errorf("unable to rename index %s: %w", legacy, err)
+			}
+		}
+	}
+	return nil
+}
+
+// qualifiedIndexName qualifies an index name with the schema of its table on postgres, where
+// indexes are looked up in the search path otherwise.
+func qualifiedIndexName(db *gorm.DB, table, index string) string {
+	schemaName, _ := splitTableName(table)
+	if schemaName == "" || db.Name() != dialectPostgres {
+		return index
+	}
+	return schemaName + "." + index
+}
+
+// migrateDepthCheckName renames the depth check of the closure table of early versions after its
+// table, MySQL requires check names to be unique in the database. sqlite scopes them to the table
+// and cannot rename them without copying the table, there the old name is kept.
+func migrateDepthCheckName[K ID](ct *TreeOf[K], db *gorm.DB) error {
+	if db.Name() == dialectSqlite {
+		return nil
+	}
+	m := db.Table(ct.relationsTbl).Migrator()
+	if !m.HasConstraint(&closureTree[K]{}, legacyDepthCheck) {
+		return nil
+	}
+	if err := m.DropConstraint(&closureTree[K]{}, legacyDepthCheck); err != nil {
+		return fmt.Errorf("unable to drop check %s: %w", legacyDepthCheck, err)
+	}
+	return m.CreateConstraint(&closureTree[K]{}, db.NamingStrategy.CheckerName(ct.relationsTbl, "depth"))
+}
+
+const legacyDepthCheck = "chk_depth"
@@ -0,0 +1,244 @@
+package closuretree_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+)
+
+func TestMigrate(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := ct.CurrentSchemaVersion(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != closuretree.SchemaVersion {
+				t.Errorf("expected schema version %d, got %d", closuretree.SchemaVersion, version)
+			}
+
+			// running again is a no-op
+			if err := ct.Migrate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			var steps int64
+			if err := gdb.Table("closure_tree_schema_test_payloads").Count(&steps).Error; err != nil {
+				t.Fatal(err)
+			}
+			if steps != int64(closuretree.SchemaVersion) {
+				t.Errorf("expected %d recorded steps, got %d", closuretree.SchemaVersion, steps)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacySchema(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+
+			// simulate a database created before the schema table existed
+			relTbl := "closure_tree_rel_test_payloads"
+			if err := gdb.Exec("DROP TABLE closure_tree_schema_test_payloads").Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.Exec("CREATE INDEX idx_desc_ten ON " + relTbl + " (descendant_id, tenant)").Error; err != nil {
+				t.Fatal(err)
+			}
+			if !gdb.Table(relTbl).Migrator().HasIndex(relTbl, "idx_desc_ten") {
+				t.Fatal("expected the legacy index to exist")
+			}
+			version, err := ct.CurrentSchemaVersion(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != 0 {
+				t.Errorf("expected schema version 0, got %d", version)
+			}
+
+			if err := ct.Migrate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if gdb.Table(relTbl).Migrator().HasIndex(relTbl, "idx_desc_ten") {
+				t.Error("expected the legacy index to be dropped")
+			}
+			version, err = ct.CurrentSchemaVersion(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != closuretree.SchemaVersion {
+				t.Errorf("expected schema version %d, got %d", closuretree.SchemaVersion, version)
+			}
+
+			var children []TestPayload
+			if err := ct.Descendants(ctx, 0, 1, tenant1, &children); err != nil {
+				t.Fatal(err)
+			}
+			if len(children) == 0 {
+				t.Error("expected the tree data to survive the migration")
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyIndexNames(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+
+			// simulate a database created before the index names were derived from the table
+			relTbl, nodesTbl := ct.GetClosureTableName(), "test_payloads"
+			indexes := []struct{ table, legacy, name string }{
+				{table: relTbl, legacy: "idx_anc_ten_dep", name: "idx_" + relTbl + "_anc_ten_dep"},
+				{table: relTbl, legacy: "idx_desc_ten_dep", name: "idx_" + relTbl + "_desc_ten_dep"},
+				{table: relTbl, legacy: "idx_closure_uniq", name: "idx_" + relTbl + "_closure_uniq"},
+				{table: nodesTbl, legacy: "idx_node_tenant", name: "idx_" + nodesTbl + "_node_tenant"},
+			}
+			for _, idx := range indexes {
+				if err := gdb.Table(idx.table).Migrator().RenameIndex(idx.table, idx.name, idx.legacy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := gdb.Exec("DELETE FROM closure_tree_schema_test_payloads WHERE version >= 3").Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ct.Migrate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			for _, idx := range indexes {
+				m := gdb.Table(idx.table).Migrator()
+				if m.HasIndex(idx.table, idx.legacy) {
+					t.Errorf("expected index %s to be renamed", idx.legacy)
+				}
+				if !m.HasIndex(idx.table, idx.name) {
+					t.Errorf("expected index %s to exist", idx.name)
+				}
+			}
+			if err := ct.CheckSchema(ctx); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyDepthCheck(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			relTbl := ct.GetClosureTableName()
+			check := "chk_" + relTbl + "_depth"
+			m := gdb.Table(relTbl).Migrator()
+			if !m.HasConstraint(relTbl, check) {
+				t.Fatalf("expected check %s to exist", check)
+			}
+			if gdb.Name() == "sqlite" {
+				t.Skip("sqlite keeps the check name of early versions")
+			}
+
+			// simulate a database created before the check name was derived from the table
+			if err := m.DropConstraint(relTbl, check); err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.Exec("ALTER TABLE " + relTbl + " ADD CONSTRAINT chk_depth CHECK (depth >= 0)").Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.Exec("DELETE FROM closure_tree_schema_test_payloads WHERE version >= 4").Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ct.Migrate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if m.HasConstraint(relTbl, "chk_depth") {
+				t.Error("expected check chk_depth to be renamed")
+			}
+			if !m.HasConstraint(relTbl, check) {
+				t.Errorf("expected check %s to exist", check)
+			}
+		})
+	}
+}
+
+func TestMigrateConcurrent(t *testing.T) {
+	const replicas = 4
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			if gdb.Name() == "sqlite" {
+				t.Skip("sqlite allows a single writer, concurrent writes fail with database locked")
+			}
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			errs := make([]error, replicas)
+			var wg sync.WaitGroup
+			for i := range replicas {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errs[i] = closuretree.New(gdb, TestPayload{})
+				}()
+			}
+			wg.Wait()
+			for _, err := range errs {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{SkipMigrate: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := ct.CurrentSchemaVersion(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != closuretree.SchemaVersion {
+				t.Errorf("expected schema version %d, got %d", closuretree.SchemaVersion, version)
+			}
+			var steps int64
+			if err := gdb.Table("closure_tree_schema_test_payloads").Count(&steps).Error; err != nil {
+				t.Fatal(err)
+			}
+			if steps != int64(closuretree.SchemaVersion) {
+				t.Errorf("expected %d recorded steps, got %d", closuretree.SchemaVersion, steps)
+			}
+		})
+	}
+}
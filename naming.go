@@ -0,0 +1,73 @@
+package closuretree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TableKind identifies one of the tables the tree creates next to the node table.
+type TableKind string
+
+const (
+	// TableClosure is the closure table holding every ancestor-descendant pair.
+	TableClosure TableKind = "rel"
+	// TableMeta holds the sort order metadata of every parent.
+	TableMeta TableKind = "meta"
+	// TableEvents is the change-event outbox, only used with Options.Events.
+	TableEvents TableKind = "events"
+	// TableHistory is the audit history, only used with Options.History.
+	TableHistory TableKind = "history"
+	// TableSchema records the applied schema migrations.
+	TableSchema TableKind = "schema"
+)
+
+// tableKinds lists every kind, in the order the tables are named.
+var tableKinds = []TableKind{TableClosure, TableMeta, TableEvents, TableHistory, TableSchema}
+
+// TableNaming returns the name of the table of the given kind for the tree stored in nodesTable.
+// The result may be qualified with a schema, e.g. "app1.tags_closure".
+type TableNaming func(kind TableKind, nodesTable string) string
+
+// DefaultTableName is the TableNaming used when Options.TableNaming is nil, it returns
+// closure_tree_<kind>_<nodes table>, e.g. closure_tree_rel_tags. A schema qualifier of the node
+// table is kept, app1.tags gives app1.closure_tree_rel_tags.
+func DefaultTableName(kind TableKind, nodesTable string) string {
+	schemaName, table := splitTableName(nodesTable)
+	name := strings.ToLower(fmt.Sprintf("closure_tree_%s_%s", kind, table))
+	if schemaName != "" {
+		return schemaName + "." + name
+	}
+	return name
+}
+
+// splitTableName splits a table name into its schema qualifier, if any, and the table.
+func splitTableName(name string) (string, string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// tableNames resolves and validates the names of all the tables of a tree.
+func tableNames(naming TableNaming, nodesTable string) (map[TableKind]string, error) {
+	if naming == nil {
+		naming = DefaultTableName
+	}
+	names := make(map[TableKind]string, len(tableKinds))
+	seen := map[string]TableKind{}
+	for _, kind := range tableKinds {
+		name := naming(kind, nodesTable)
+		if err := validateTableName(name); err != nil {
+			return nil, err
+		}
+		if name == nodesTable {
+			return nil, fmt.Errorf("invalid table name %q for %s: same as the node table", name, kind)
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("invalid table name %q for %s: already used for %s", name, kind, other)
+		}
+		seen[name] = kind
+		names[kind] = name
+	}
+	return names, nil
+}
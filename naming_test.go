@@ -0,0 +1,192 @@
+package closuretree_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/gorm"
+)
+
+func TestDefaultTableName(t *testing.T) {
+	tcs := []struct {
+		kind  closuretree.TableKind
+		nodes string
+		want  string
+	}{
+		{kind: closuretree.TableClosure, nodes: "tags", want: "closure_tree_rel_tags"},
+		{kind: closuretree.TableMeta, nodes: "tags", want: "closure_tree_meta_tags"},
+		{kind: closuretree.TableSchema, nodes: "tags", want: "closure_tree_schema_tags"},
+		{kind: closuretree.TableClosure, nodes: "app1.tags", want: "app1.closure_tree_rel_tags"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.want, func(t *testing.T) {
+			if got := closuretree.DefaultTableName(tc.kind, tc.nodes); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTableNaming(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			tcs := []struct {
+				name   string
+				schema string
+				naming closuretree.TableNaming
+			}{
+				{
+					name:   "prefix",
+					naming: func(kind closuretree.TableKind, nodes string) string { return fmt.Sprintf("app1_%s_%s", nodes, kind) },
+				},
+				{
+					// sqlite and mysql schemas are databases, only postgres is tested
+					name:   "schema",
+					schema: "app1",
+					naming: func(kind closuretree.TableKind, nodes string) string { return fmt.Sprintf("app1.%s_%s", nodes, kind) },
+				},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					if tc.schema != "" {
+						if gdb.Name() != "postgres" {
+							t.Skip("schema-qualified tables are only tested on postgres")
+						}
+						if err := gdb.Exec("CREATE SCHEMA IF NOT EXISTS " + tc.schema).Error; err != nil {
+							t.Fatal(err)
+						}
+					}
+					dropNamedTables(gdb, tc.naming, "test_payloads")
+					gdb.Exec("DROP TABLE IF EXISTS test_payloads")
+					opts := closuretree.Options{TableNaming: tc.naming, Events: true, History: true}
+					ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					wantRel := tc.naming(closuretree.TableClosure, "test_payloads")
+					if got := ct.GetClosureTableName(); got != wantRel {
+						t.Errorf("expected closure table %q, got %q", wantRel, got)
+					}
+					if err := ct.CheckSchema(context.Background()); err != nil {
+						t.Fatal(err)
+					}
+
+					populateTree(t, ct)
+					ctx := context.Background()
+					newParent := uint(3)
+					if err := ct.Update(ctx, 4, nil, &newParent, nil, tenant1); err != nil {
+						t.Fatal(err)
+					}
+					got, err := ct.DescendantIds(ctx, 3, 0, tenant1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					slices.Sort(got)
+					if diff := cmp.Diff(got, []uint{4, 5}); diff != "" {
+						t.Errorf("unexpected descendants (-got +want):\n%s", diff)
+					}
+					if err := ct.DeleteRecurse(ctx, 1, tenant1); err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestTableNamingCoexist(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			ctx := context.Background()
+			prefixed := func(prefix string) closuretree.TableNaming {
+				return func(kind closuretree.TableKind, nodes string) string {
+					return fmt.Sprintf("%s_%s_%s", prefix, nodes, kind)
+				}
+			}
+			dropNamedTables(gdb, prefixed("app1"), "test_payloads")
+			dropNamedTables(gdb, prefixed("app2"), "multi_level_payloads")
+			gdb.Exec("DROP TABLE IF EXISTS test_payloads")
+			gdb.Exec("DROP TABLE IF EXISTS multi_level_payloads")
+
+			// both trees live in the same database, their indexes must not collide
+			ct1, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{TableNaming: prefixed("app1"), History: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ct2, err := closuretree.NewWithOptions(gdb, MultiLevelPayload{}, closuretree.Options{TableNaming: prefixed("app2"), History: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, ct := range []*closuretree.Tree{ct1, ct2} {
+				if err := ct.CheckSchema(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			populateTree(t, ct1)
+			item := MultiLevelPayload{Name: "root"}
+			if err := ct2.Add(ctx, &item, 0, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			child := MultiLevelPayload{Name: "child"}
+			if err := ct2.Add(ctx, &child, item.NodeId, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ct2.DescendantIds(ctx, item.NodeId, 0, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, []uint{child.NodeId}); diff != "" {
+				t.Errorf("unexpected descendants (-got +want):\n%s", diff)
+			}
+			if _, err := ct1.DescendantIds(ctx, 1, 0, tenant1); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestTableNamingInvalid(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			tcs := []struct {
+				name   string
+				naming closuretree.TableNaming
+			}{
+				{name: "upper case", naming: func(kind closuretree.TableKind, nodes string) string { return "Tree_" + string(kind) }},
+				{name: "duplicate", naming: func(kind closuretree.TableKind, nodes string) string { return "tree_tables" }},
+				{name: "node table", naming: func(kind closuretree.TableKind, nodes string) string { return nodes }},
+				{name: "nested schema", naming: func(kind closuretree.TableKind, nodes string) string { return "a.b.tree_" + string(kind) }},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					opts := closuretree.Options{TableNaming: tc.naming, SkipMigrate: true}
+					if _, err := closuretree.NewWithOptions(gdb, TestPayload{}, opts); err == nil {
+						t.Error("expected an error for an invalid table naming")
+					}
+				})
+			}
+		})
+	}
+}
+
+// dropNamedTables drops the tree tables named by naming, ensuring a clean state when tests run
+// with -count > 1.
+func dropNamedTables(gdb *gorm.DB, naming closuretree.TableNaming, nodes string) {
+	kinds := []closuretree.TableKind{
+		closuretree.TableClosure, closuretree.TableMeta, closuretree.TableEvents,
+		closuretree.TableHistory, closuretree.TableSchema,
+	}
+	for _, kind := range kinds {
+		gdb.Exec("DROP TABLE IF EXISTS " + naming(kind, nodes))
+	}
+}
@@ -2,15 +2,27 @@ package closuretree
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"reflect"
+	"slices"
+
+	"github.com/google/uuid"
 )
 
+// ID is the type of the node IDs of a tree, defined by the embedded node struct: uint with Node,
+// uint64 with Node64 and string with NodeUUID or NodeString. The zero value is the root sentinel,
+// root nodes have the parent 0, or "" with string keys.
+type ID interface {
+	uint | uint64 | string
+}
+
 // Node is an embeddable ID to be used in closure tree, this is mandatory.
 // ParentId is ignored during write operations, it is only populated during read.
 type Node struct {
-	NodeId    uint    `gorm:"autoIncrement;primaryKey;not null;index:idx_node_tenant,composite:2" json:"id"`
+	NodeId    uint    `gorm:"autoIncrement;primaryKey;not null;index:,composite:node_tenant" json:"id"`
 	ParentId  uint    `json:"parentId" gorm:"column:parent_id;->;-:migration"` // field is Read-only, no migration
-	Tenant    string  `gorm:"not null;index:idx_node_tenant,composite:1" json:"tenant"`
+	Tenant    string  `gorm:"not null;index:,composite:node_tenant" json:"tenant"`
 	SortOrder float64 `gorm:"not null;default:0" json:"sortOrder"`
 }
 
@@ -22,11 +34,74 @@ func (n *Node) Parent() uint {
 	return n.ParentId
 }
 
+// Node64 is the Node of trees with uint64 IDs, created with NewOf[uint64].
+type Node64 struct {
+	NodeId    uint64  `gorm:"autoIncrement;primaryKey;not null;index:,composite:node_tenant" json:"id"`
+	ParentId  uint64  `json:"parentId" gorm:"column:parent_id;->;-:migration"` // field is Read-only, no migration
+	Tenant    string  `gorm:"not null;index:,composite:node_tenant" json:"tenant"`
+	SortOrder float64 `gorm:"not null;default:0" json:"sortOrder"`
+}
+
+func (n *Node64) Id() uint64 {
+	return n.NodeId
+}
+
+func (n *Node64) Parent() uint64 {
+	return n.ParentId
+}
+
+// NodeUUID is the Node of trees with UUID keys, created with NewOf[string]. Add keeps the NodeId
+// set by the caller and generates a UUIDv7 if it is empty.
+type NodeUUID struct {
+	NodeId    string  `gorm:"primaryKey;size:36;not null;index:,composite:node_tenant" json:"id"`
+	ParentId  string  `json:"parentId" gorm:"column:parent_id;size:36;->;-:migration"` // field is Read-only, no migration
+	Tenant    string  `gorm:"not null;index:,composite:node_tenant" json:"tenant"`
+	SortOrder float64 `gorm:"not null;default:0" json:"sortOrder"`
+}
+
+func (n *NodeUUID) Id() string {
+	return n.NodeId
+}
+
+func (n *NodeUUID) Parent() string {
+	return n.ParentId
+}
+
+// NodeString is the Node of trees with string keys chosen by the application, created with
+// NewOf[string]. Add requires the NodeId to be set, it returns ErrEmptyNodeID otherwise.
+type NodeString struct {
+	NodeId    string  `gorm:"primaryKey;size:191;not null;index:,composite:node_tenant" json:"id"`
+	ParentId  string  `json:"parentId" gorm:"column:parent_id;size:191;->;-:migration"` // field is Read-only, no migration
+	Tenant    string  `gorm:"not null;index:,composite:node_tenant" json:"tenant"`
+	SortOrder float64 `gorm:"not null;default:0" json:"sortOrder"`
+}
+
+func (n *NodeString) Id() string {
+	return n.NodeId
+}
+
+func (n *NodeString) Parent() string {
+	return n.ParentId
+}
+
+// ErrEmptyNodeID is returned by Add for an item embedding NodeString without a NodeId.
+var ErrEmptyNodeID = errors.New("the node ID must be set for string keys")
+
 const nodeIDField = "NodeId"
 const tenantIdField = "Tenant"
 
-// hasNode uses reflection to verify if the passed struct has the embedded Node struct
-func hasNode(item any) bool {
+// nodeTypes are the embeddable node structs.
+var nodeTypes = []reflect.Type{
+	reflect.TypeOf(Node{}), reflect.TypeOf(Node64{}), reflect.TypeOf(NodeUUID{}), reflect.TypeOf(NodeString{}),
+}
+
+// isNodeType reports whether t is one of the embeddable node structs.
+func isNodeType(t reflect.Type) bool {
+	return slices.Contains(nodeTypes, t)
+}
+
+// hasNode uses reflection to verify if the passed struct has an embedded node struct with IDs of type K
+func hasNode[K ID](item any) bool {
 	if item == nil {
 		return false
 	}
@@ -40,55 +115,71 @@ func hasNode(item any) bool {
 		return false
 	}
 
-	return hasNodeType(itemType)
+	nodeType, ok := nodeTypeOf(itemType)
+	return ok && hasIDType[K](nodeType)
 }
 
-func hasNodeType(t reflect.Type) bool {
-	if t == reflect.TypeOf(Node{}) {
-		return true
+// hasNodeOfAnyID reports whether the passed struct embeds one of the node structs, whatever its ID type.
+func hasNodeOfAnyID(item any) bool {
+	return hasNode[uint](item) || hasNode[uint64](item) || hasNode[string](item)
+}
+
+// nodeTypeOf returns the node struct t is or embeds, directly or through other embedded structs.
+func nodeTypeOf(t reflect.Type) (reflect.Type, bool) {
+	if isNodeType(t) {
+		return t, true
 	}
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
-		if f.Anonymous && f.Type.Kind() == reflect.Struct && hasNodeType(f.Type) {
-			return true
+		if !f.Anonymous || f.Type.Kind() != reflect.Struct {
+			continue
+		}
+		if nodeType, ok := nodeTypeOf(f.Type); ok {
+			return nodeType, true
 		}
 	}
-	return false
+	return nil, false
 }
 
-func getNodeData(item interface{}) (uint, string, error) {
+// hasIDType reports whether the node struct nodeType has IDs of type K.
+func hasIDType[K ID](nodeType reflect.Type) bool {
+	f, ok := nodeType.FieldByName(nodeIDField)
+	return ok && f.Type == reflect.TypeFor[K]()
+}
+
+func getNodeData[K ID](item interface{}) (K, string, error) {
+	var id K
 	if item == nil {
-		return 0, "", errors.New("getNodeData: item cannot be nil")
+		return id, "", errors.New("getNodeData: item cannot be nil")
 	}
 
 	itemType, itemValue := dereference(item)
 	if itemType.Kind() != reflect.Struct {
-		return 0, "", errors.New("getNodeData: item is not a struct")
+		return id, "", errors.New("getNodeData: item is not a struct")
 	}
 
-	// Try to extract data if it's a Node struct
-	if itemType == reflect.TypeOf(Node{}) {
-		return extractNodeFields(itemValue)
+	// Try to extract data if it's a node struct
+	if isNodeType(itemType) {
+		return extractNodeFields[K](itemValue)
 	}
 
-	// Try to extract from anonymous embedded Node (supports multi-level embedding)
+	// Try to extract from anonymous embedded node (supports multi-level embedding)
 	if v, ok := findNodeValue(itemType, itemValue); ok {
-		return extractNodeFields(v)
+		return extractNodeFields[K](v)
 	}
 
-	return 0, "", errors.New("struct Node not found")
+	return id, "", errors.New("struct Node not found")
 }
 
-// findNodeValue recursively searches for an embedded Node field and returns its reflect.Value.
+// findNodeValue recursively searches for an embedded node field and returns its reflect.Value.
 func findNodeValue(t reflect.Type, v reflect.Value) (reflect.Value, bool) {
-	nodeType := reflect.TypeOf(Node{})
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		if !f.Anonymous {
 			continue
 		}
 		fv := v.Field(i)
-		if f.Type == nodeType {
+		if isNodeType(f.Type) {
 			return fv, true
 		}
 		if f.Type.Kind() == reflect.Struct {
@@ -111,9 +202,9 @@ func dereference(item interface{}) (reflect.Type, reflect.Value) {
 	return t, v
 }
 
-func extractNodeFields(val reflect.Value) (uint, string, error) {
+func extractNodeFields[K ID](val reflect.Value) (K, string, error) {
 	var tenant string
-	var id uint
+	var id K
 
 	tenantField := val.FieldByName(tenantIdField)
 	if tenantField.IsValid() {
@@ -121,9 +212,72 @@ func extractNodeFields(val reflect.Value) (uint, string, error) {
 	}
 
 	idField := val.FieldByName(nodeIDField)
-	if idField.IsValid() && idField.CanUint() {
-		id = uint(idField.Uint())
+	if idField.IsValid() && idField.CanInterface() {
+		id, _ = idField.Interface().(K)
 	}
 
 	return id, tenant, nil
 }
+
+// initNode sets the node struct of an item about to be added: the tenant and the sort order, any
+// other value is cleared. Integer IDs are assigned by the database, string IDs are kept and
+// generated for NodeUUID if empty.
+func initNode(node reflect.Value, tenant string, sortOrder float64) error {
+	var id string
+	if idField := node.FieldByName(nodeIDField); idField.Kind() == reflect.String {
+		id = idField.String()
+		if id == "" && node.Type() == reflect.TypeOf(NodeUUID{}) {
+			u, err := uuid.NewV7()
+			if err != nil {
+				return fmt.Errorf("unable to generate node ID: %w", err)
+			}
+			id = u.String()
+		}
+		if id == "" {
+			return ErrEmptyNodeID
+		}
+	}
+	node.Set(reflect.Zero(node.Type()))
+	if id != "" {
+		node.FieldByName(nodeIDField).SetString(id)
+	}
+	node.FieldByName(tenantIdField).SetString(tenant)
+	node.FieldByName("SortOrder").SetFloat(sortOrder)
+	return nil
+}
+
+// isRoot reports whether id is the root sentinel, the zero value of K.
+func isRoot[K ID](id K) bool {
+	var root K
+	return id == root
+}
+
+// toID converts a node ID column value to K, handling the types returned by the different drivers.
+func toID[K ID](v any) (K, bool) {
+	var id K
+	switch p := any(&id).(type) {
+	case *string:
+		switch s := v.(type) {
+		case nil:
+		case string:
+			*p = s
+		case []byte:
+			*p = string(s)
+		default:
+			return id, false
+		}
+	case *uint:
+		n, ok := toInt64(v)
+		if !ok || n < 0 || uint64(n) > math.MaxUint {
+			return id, false
+		}
+		*p = uint(n)
+	case *uint64:
+		n, ok := toInt64(v)
+		if !ok || n < 0 {
+			return id, false
+		}
+		*p = uint64(n)
+	}
+	return id, true
+}
@@ -1,8 +1,12 @@
 package closuretree
 
 import (
+	"errors"
 	"math"
+	"reflect"
 	"testing"
+
+	"github.com/google/uuid"
 )
 
 type tag struct {
@@ -10,6 +14,11 @@ type tag struct {
 	Node
 }
 
+type uuidTag struct {
+	Name string
+	NodeUUID
+}
+
 type nonEmbeddingStruct struct {
 	Name string
 }
@@ -40,6 +49,11 @@ func TestHasBranch(t *testing.T) {
 			input:    &tag{},
 			expected: true,
 		},
+		{
+			name:     "Struct that embeds Node with other key type",
+			input:    uuidTag{},
+			expected: false,
+		},
 		{
 			name:     "Struct that does not embed Node",
 			input:    nonEmbeddingStruct{Name: "test"},
@@ -69,7 +83,7 @@ func TestHasBranch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := hasNode(tt.input)
+			result := hasNode[uint](tt.input)
 			if result != tt.expected {
 				t.Errorf("hasNode(%v) = %v; want %v", tt.input, result, tt.expected)
 			}
@@ -140,7 +154,7 @@ func TestGetNodeData(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			id, tenant, err := getNodeData(tt.input)
+			id, tenant, err := getNodeData[uint](tt.input)
 			if (err != nil) != tt.hasError {
 				t.Errorf("getNodeData(%v) unexpected error state: %v", tt.input, err)
 			}
@@ -190,3 +204,69 @@ func TestToInt64(t *testing.T) {
 		})
 	}
 }
+
+func TestToID(t *testing.T) {
+	t.Run("uint", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			input  any
+			want   uint
+			wantOK bool
+		}{
+			{"nil", nil, 0, true},
+			{"int64", int64(42), 42, true},
+			{"[]byte", []byte("7"), 7, true},
+			{"negative", int64(-1), 0, false},
+			{"string invalid", "abc", 0, false},
+		}
+		for _, tt := range tests {
+			got, ok := toID[uint](tt.input)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("%s: toID(%v) = %v, %v; want %v, %v", tt.name, tt.input, got, ok, tt.want, tt.wantOK)
+			}
+		}
+	})
+	t.Run("string", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			input  any
+			want   string
+			wantOK bool
+		}{
+			{"nil", nil, "", true},
+			{"string", "a1", "a1", true},
+			{"[]byte", []byte("b2"), "b2", true},
+			{"int64", int64(3), "", false},
+		}
+		for _, tt := range tests {
+			got, ok := toID[string](tt.input)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("%s: toID(%v) = %q, %v; want %q, %v", tt.name, tt.input, got, ok, tt.want, tt.wantOK)
+			}
+		}
+	})
+}
+
+func TestInitNode(t *testing.T) {
+	var item struct{ NodeUUID }
+	item.NodeId = ""
+	item.ParentId = "stale"
+	if err := initNode(reflect.ValueOf(&item).Elem().Field(0), "t1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uuid.Parse(item.NodeId); err != nil {
+		t.Errorf("expected a generated UUID, got %q: %v", item.NodeId, err)
+	}
+	if item.ParentId != "" || item.Tenant != "t1" || item.SortOrder != 2 {
+		t.Errorf("unexpected node %+v", item.NodeUUID)
+	}
+
+	var str struct{ NodeString }
+	if err := initNode(reflect.ValueOf(&str).Elem().Field(0), "t1", 1); !errors.Is(err, ErrEmptyNodeID) {
+		t.Errorf("expected ErrEmptyNodeID, got %v", err)
+	}
+	str.NodeId = "key"
+	if err := initNode(reflect.ValueOf(&str).Elem().Field(0), "t1", 1); err != nil || str.NodeId != "key" {
+		t.Errorf("expected the node ID to be kept, got %q: %v", str.NodeId, err)
+	}
+}
@@ -0,0 +1,284 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/uuid"
+)
+
+type Doc64 struct {
+	closuretree.Node64
+	Name string
+}
+
+type DocUUID struct {
+	closuretree.NodeUUID
+	Name string
+}
+
+type DocKey struct {
+	closuretree.NodeString
+	Name string
+}
+
+var idTreeOpts = closuretree.Options{Events: true, History: true, StoreParentID: true}
+
+// checkIDTree builds the tree
+//
+//	a
+//	├── b
+//	│   └── c
+//	d
+//
+// then moves b to the root, rebuilds it with c under d and deletes d, verifying the tree after
+// every step. add adds an item with the given name under parent and returns its ID.
+func checkIDTree[K closuretree.ID](t *testing.T, ct *closuretree.TreeOf[K], add func(name string, parent K) K) {
+	t.Helper()
+	ctx := context.Background()
+	var root K
+
+	a := add("a", root)
+	b := add("b", a)
+	c := add("c", b)
+	d := add("d", root)
+
+	ids, err := ct.DescendantIds(ctx, a, 0, tenant1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != b || ids[1] != c {
+		t.Errorf("expected descendants [%v %v] of a, got %v", b, c, ids)
+	}
+	ok, err := ct.IsChildOf(ctx, c, b, tenant1)
+	if err != nil || !ok {
+		t.Errorf("expected c to be a child of b: %v", err)
+	}
+	tree, err := ct.TreeDescendantsIds(ctx, root, 0, tenant1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// d is added last at the first position
+	if len(tree) != 2 || tree[0].NodeId != d || tree[1].NodeId != a || len(tree[1].Children) != 1 ||
+		tree[1].Children[0].NodeId != b || tree[1].Children[0].ParentID != a {
+		t.Errorf("unexpected tree %+v", tree)
+	}
+
+	if err := ct.Update(ctx, b, nil, &root, nil, tenant1); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = ct.IsDescendant(ctx, a, c, tenant1)
+	if err != nil || ok {
+		t.Errorf("expected c to be moved out of a: %v", err)
+	}
+	verifyIDTree(t, ct)
+	if err := ct.Rebuild(ctx, tenant1, map[K]K{b: root, c: d}); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = ct.IsChildOf(ctx, c, d, tenant1)
+	if err != nil || !ok {
+		t.Errorf("expected c to be a child of d after the rebuild: %v", err)
+	}
+	verifyIDTree(t, ct)
+
+	history, err := ct.History(ctx, b, tenant1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].Op != closuretree.EventMove || *history[1].OldParentID != a ||
+		*history[1].NewParentID != root {
+		t.Errorf("unexpected history of b %+v", history)
+	}
+	if err := ct.DeleteRecurse(ctx, d, tenant1); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = ct.DescendantIds(ctx, root, 0, tenant1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected the nodes a and b to be left, got %v", ids)
+	}
+	events, err := ct.ReadEvents(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := events[len(events)-1]
+	if last.Op != closuretree.EventDelete || last.NodeID != c {
+		t.Errorf("expected the last event to delete c, got %+v", last)
+	}
+	verifyIDTree(t, ct)
+	if err := ct.CheckSchema(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func verifyIDTree[K closuretree.ID](t *testing.T, ct *closuretree.TreeOf[K]) {
+	t.Helper()
+	report, err := ct.Verify(context.Background(), tenant1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("unexpected integrity problems %+v", report)
+	}
+}
+
+func TestUint64IDs(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, Doc64{})
+			ctx := context.Background()
+
+			ct, err := closuretree.NewOf[uint64](gdb, Doc64{}, idTreeOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkIDTree(t, ct, func(name string, parent uint64) uint64 {
+				item := &Doc64{Name: name}
+				if err := ct.Add(ctx, item, parent, 0, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				return item.NodeId
+			})
+		})
+	}
+}
+
+func TestUUIDIDs(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, DocUUID{})
+			ctx := context.Background()
+
+			ct, err := closuretree.NewOf[string](gdb, DocUUID{}, idTreeOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkIDTree(t, ct, func(name string, parent string) string {
+				item := &DocUUID{Name: name}
+				if err := ct.Add(ctx, item, parent, "", tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := uuid.Parse(item.NodeId); err != nil {
+					t.Fatalf("expected a generated UUID, got %q: %v", item.NodeId, err)
+				}
+				return item.NodeId
+			})
+
+			// an ID set by the caller is kept
+			id := uuid.NewString()
+			if err := ct.Add(ctx, &DocUUID{NodeUUID: closuretree.NodeUUID{NodeId: id}, Name: "e"}, "", "", tenant1); err != nil {
+				t.Fatal(err)
+			}
+			var got DocUUID
+			if err := ct.GetNode(ctx, id, tenant1, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != "e" || got.ParentId != "" {
+				t.Errorf("unexpected node %+v", got)
+			}
+		})
+	}
+}
+
+func TestStringIDs(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, DocKey{})
+			ctx := context.Background()
+
+			ct, err := closuretree.NewOf[string](gdb, DocKey{}, idTreeOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ct.Add(ctx, &DocKey{Name: "no key"}, "", "", tenant1)
+			if !errors.Is(err, closuretree.ErrEmptyNodeID) {
+				t.Errorf("expected ErrEmptyNodeID, got %v", err)
+			}
+			checkIDTree(t, ct, func(name string, parent string) string {
+				item := &DocKey{NodeString: closuretree.NodeString{NodeId: "key-" + name}, Name: name}
+				if err := ct.Add(ctx, item, parent, "", tenant1); err != nil {
+					t.Fatal(err)
+				}
+				return item.NodeId
+			})
+
+			var children []DocKey
+			if err := ct.Descendants(ctx, "key-a", 1, tenant1, &children); err != nil {
+				t.Fatal(err)
+			}
+			if len(children) != 0 {
+				t.Errorf("expected a to have no children left, got %+v", children)
+			}
+			var got DocKey
+			if err := ct.GetNode(ctx, "key-b", tenant1, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != "b" || got.ParentId != "" {
+				t.Errorf("unexpected node %+v", got)
+			}
+		})
+	}
+}
+
+func TestNewOfIDTypeMismatch(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+
+			_, err := closuretree.NewOf[string](gdb, TestPayload{}, closuretree.Options{SkipMigrate: true})
+			if !errors.Is(err, closuretree.ErrItemIsNotTreeNode) {
+				t.Errorf("expected ErrItemIsNotTreeNode, got %v", err)
+			}
+			_, err = closuretree.New(gdb, DocUUID{})
+			if !errors.Is(err, closuretree.ErrItemIsNotTreeNode) {
+				t.Errorf("expected ErrItemIsNotTreeNode, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDDLStringIDs(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, DocUUID{})
+
+			ct, err := closuretree.NewOf[string](gdb, DocUUID{}, closuretree.Options{StoreParentID: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				dialect string
+				want    []string
+			}{
+				{dialect: "sqlite", want: []string{`"node_id" text NOT NULL`, `"ancestor_id" text NOT NULL`,
+					`"parent_id" text NOT NULL DEFAULT ''`}},
+				{dialect: "postgres", want: []string{`"node_id" varchar(36) NOT NULL`, `"ancestor_id" text NOT NULL`,
+					`"parent_id" varchar(36) NOT NULL DEFAULT ''`}},
+				{dialect: "mysql", want: []string{"`node_id` varchar(36) NOT NULL", "`ancestor_id` varchar(191) NOT NULL",
+					"`parent_id` varchar(36) NOT NULL DEFAULT ''"}},
+			}
+			for _, tc := range tests {
+				stmts, err := ct.DDL(tc.dialect)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ddl := strings.Join(stmts, "\n")
+				for _, want := range tc.want {
+					if !strings.Contains(ddl, want) {
+						t.Errorf("%s: expected the DDL to contain %q, got\n%s", tc.dialect, want, ddl)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package closuretree
+
+import (
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// parentIDColumn is the node table column holding the parent ID with Options.StoreParentID.
+const parentIDColumn = "parent_id"
+
+// parentIndexName returns the name of the (tenant, parent_id) index of the node table.
+func (ct *TreeOf[K]) parentIndexName() string {
+	_, table := splitTableName(ct.nodesTbl)
+	return fmt.Sprintf("idx_%s_parent", table)
+}
+
+// parentColumnDef returns the column definition of parent_id for the dialect, root nodes hold the
+// root sentinel.
+func (ct *TreeOf[K]) parentColumnDef(dialect string) (string, error) {
+	sch, err := ct.parseModel(ct.nodeModel(), ct.nodesTbl)
+	if err != nil {
+		return "", err
+	}
+	field := sch.LookUpField(parentIDColumn)
+	if field == nil {
+		return "", fmt.Errorf("field %s not found in %s", parentIDColumn, ct.nodesTbl)
+	}
+	dflt := "0"
+	if field.DataType == schema.String {
+		dflt = "''"
+	}
+	return fmt.Sprintf("%s %s NOT NULL DEFAULT %s", quoteIdent(dialect, parentIDColumn), columnType(dialect, field), dflt), nil
+}
+
+// parentIndexSQL returns the statement creating the (tenant, parent_id) index for the dialect.
+func (ct *TreeOf[K]) parentIndexSQL(dialect string) string {
+	q := func(name string) string { return quoteIdent(dialect, name) }
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s, %s)", q(ct.parentIndexName()), q(ct.nodesTbl), q("tenant"), q(parentIDColumn))
+}
+
+// migrateParentIDColumn adds the parent_id column and its index to the node table, filling the
+// column from the depth 1 closure rows when it is added.
+func (ct *TreeOf[K]) migrateParentIDColumn(db *gorm.DB) error {
+	m := db.Table(ct.nodesTbl).Migrator()
+	model := ct.nodeModel()
+	if !m.HasColumn(model, parentIDColumn) {
+		def, err := ct.parentColumnDef(db.Name())
+		if err != nil {
+			return err
+		}
+		var root K
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s", ct.nodesTbl, def)).Error; err != nil {
+				return fmt.Errorf("unable to add the parent_id column: %w", err)
+			}
+			if err := tx.Exec(fmt.Sprintf(backfillParentIDQuery, ct.nodesTbl, ct.relationsTbl), root).Error; err != nil {
+				return fmt.Errorf("unable to fill the parent_id column: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !m.HasIndex(model, ct.parentIndexName()) {
+		if err := db.Exec(ct.parentIndexSQL(db.Name())).Error; err != nil {
+			return fmt.Errorf("unable to create the parent_id index: %w", err)
+		}
+	}
+	return nil
+}
+
+const backfillParentIDQuery = `UPDATE %s AS n SET parent_id = COALESCE((
+	SELECT MIN(r.ancestor_id) FROM %s r
+	WHERE r.descendant_id = n.node_id AND r.depth = 1 AND r.tenant = n.tenant
+), ?)`
+
+// setParentIDInTx stores parentID as the parent of node id, if enabled in the options.
+func (ct *TreeOf[K]) setParentIDInTx(tx *gorm.DB, id, parentID K, tenant string) error {
+	if !ct.opts.StoreParentID {
+		return nil
+	}
+	err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE node_id = ? AND tenant = ?`, ct.nodesTbl, parentIDColumn),
+		parentID, id, tenant).Error
+	if err != nil {
+		return fmt.Errorf("unable to store the parent of node %v: %w", id, err)
+	}
+	return nil
+}
+
+// setParentIDsInTx stores the parent of every node in parentOf, if enabled in the options.
+func (ct *TreeOf[K]) setParentIDsInTx(tx *gorm.DB, parentOf map[K]K, tenant string) error {
+	if !ct.opts.StoreParentID {
+		return nil
+	}
+	byParent := map[K][]K{}
+	for id, parentID := range parentOf {
+		byParent[parentID] = append(byParent[parentID], id)
+	}
+	query := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE tenant = ? AND node_id IN ?`, ct.nodesTbl, parentIDColumn)
+	for parentID, ids := range byParent {
+		slices.Sort(ids)
+		for batch := range slices.Chunk(ids, rebuildBatchSize) {
+			if err := tx.Exec(query, parentID, tenant, batch).Error; err != nil {
+				return fmt.Errorf("unable to store the parent of nodes: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package closuretree_test
+
+import (
+	"context"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/gorm"
+)
+
+// storedParents returns the parent_id column of the nodes of a tenant.
+func storedParents(t *testing.T, gdb *gorm.DB, tenant string) map[uint]uint {
+	t.Helper()
+	var rows []struct {
+		NodeID   uint
+		ParentID uint
+	}
+	err := gdb.Table("test_payloads").Select("node_id, parent_id").Where("tenant = ?", tenant).Scan(&rows).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[uint]uint{}
+	for _, row := range rows {
+		got[row.NodeID] = row.ParentID
+	}
+	return got
+}
+
+func TestStoreParentID(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{StoreParentID: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+			want := map[uint]uint{1: 0, 2: 1, 3: 0, 4: 1, 5: 3, 6: 2}
+			if diff := cmp.Diff(storedParents(t, gdb, tenant1), want); diff != "" {
+				t.Errorf("unexpected parents after add (-got +want):\n%s", diff)
+			}
+
+			newParent := uint(3)
+			if err := ct.Update(ctx, 4, nil, &newParent, nil, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			want[4] = 3
+			if diff := cmp.Diff(storedParents(t, gdb, tenant1), want); diff != "" {
+				t.Errorf("unexpected parents after move (-got +want):\n%s", diff)
+			}
+
+			var node TestPayload
+			if err := ct.GetNode(ctx, 4, tenant1, &node); err != nil {
+				t.Fatal(err)
+			}
+			if node.Parent() != 3 {
+				t.Errorf("expected GetNode to return parent 3, got %d", node.Parent())
+			}
+			var children []TestPayload
+			if err := ct.Descendants(ctx, 3, 1, tenant1, &children); err != nil {
+				t.Fatal(err)
+			}
+			for _, child := range children {
+				if child.Parent() != 3 {
+					t.Errorf("expected Descendants to return parent 3 for node %d, got %d", child.Id(), child.Parent())
+				}
+			}
+
+			if err := ct.TransferSubtree(ctx, 2, tenant1, tenant2, 7, 0, false); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, 2)
+			delete(want, 6)
+			if diff := cmp.Diff(storedParents(t, gdb, tenant1), want); diff != "" {
+				t.Errorf("unexpected parents after transfer (-got +want):\n%s", diff)
+			}
+			if got := storedParents(t, gdb, tenant2); got[2] != 7 || got[6] != 2 {
+				t.Errorf("unexpected parents of the transferred nodes: %v", got)
+			}
+
+			if err := ct.Rebuild(ctx, tenant1, map[uint]uint{4: 1, 5: 4}); err != nil {
+				t.Fatal(err)
+			}
+			want = map[uint]uint{1: 0, 3: 0, 4: 1, 5: 4}
+			if diff := cmp.Diff(storedParents(t, gdb, tenant1), want); diff != "" {
+				t.Errorf("unexpected parents after rebuild (-got +want):\n%s", diff)
+			}
+
+			for _, tenant := range []string{tenant1, tenant2} {
+				report, err := ct.Verify(ctx, tenant)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !report.OK() {
+					t.Errorf("unexpected problems in %s: %+v", tenant, report)
+				}
+			}
+
+			if err := gdb.Exec("UPDATE test_payloads SET parent_id = 3 WHERE node_id = 5").Error; err != nil {
+				t.Fatal(err)
+			}
+			report, err := ct.Verify(ctx, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(report, closuretree.Report{ParentMismatches: []uint{5}}); diff != "" {
+				t.Errorf("unexpected report (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStoreParentIDBackfill(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+
+			stored, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{StoreParentID: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := stored.CheckSchema(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			want := map[uint]uint{1: 0, 2: 1, 3: 0, 4: 1, 5: 3, 6: 2}
+			if diff := cmp.Diff(storedParents(t, gdb, tenant1), want); diff != "" {
+				t.Errorf("unexpected parents (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStoreParentIDDDL(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+
+			opts := closuretree.Options{SkipMigrate: true, StoreParentID: true}
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stmts, err := ct.DDL(gdb.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, stmt := range stmts {
+				if err := gdb.Exec(stmt).Error; err != nil {
+					t.Fatalf("unable to run %q: %v", stmt, err)
+				}
+			}
+			if err := ct.CheckSchema(ctx); err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+			if got := storedParents(t, gdb, tenant1); got[6] != 2 {
+				t.Errorf("expected parent 2 for node 6, got %d", got[6])
+			}
+		})
+	}
+}
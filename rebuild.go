@@ -0,0 +1,185 @@
+package closuretree
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidAdjacency is returned by Rebuild when the parent links do not form a tree.
+var ErrInvalidAdjacency = errors.New("invalid parent links")
+
+// rebuildBatchSize is the number of closure or meta rows inserted per statement by Rebuild.
+const rebuildBatchSize = 1000
+
+// Rebuild regenerates the closure and meta rows of a tenant from parent links, e.g. after
+// importing data or to repair the problems reported by Verify. parents maps node IDs to the ID
+// of their parent, 0 (the zero value of K) for root nodes; nodes of the tenant missing from the map are placed at the
+// root. A nil map uses the current depth 1 closure rows as parent links.
+//
+// All the closure and meta rows of the tenant are replaced in a single transaction, node rows
+// and sort orders are not changed, except for the parent_id column with Options.StoreParentID.
+// Rebuild does not call hooks nor record events or history.
+func (ct *TreeOf[K]) Rebuild(ctx context.Context, tenant string, parents map[K]K) error {
+	tenant, err := validateTenant(tenant)
+	if err != nil {
+		return err
+	}
+	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var nodes []rebuildNode[K]
+		err := tx.Table(ct.nodesTbl).Select("node_id, sort_order").
+			Where("tenant = ?", tenant).Order("node_id").Scan(&nodes).Error
+		if err != nil {
+			return fmt.Errorf("rebuild: failed to load nodes: %w", err)
+		}
+		if parents == nil {
+			if parents, err = ct.currentParentsInTx(tx, tenant); err != nil {
+				return err
+			}
+		}
+		parentOf, err := rebuildParents(nodes, parents)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ?`, ct.relationsTbl), tenant).Error; err != nil {
+			return fmt.Errorf("rebuild: failed to delete closure rows: %w", err)
+		}
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ?`, ct.metaTbl), tenant).Error; err != nil {
+			return fmt.Errorf("rebuild: failed to delete meta rows: %w", err)
+		}
+		if err := ct.insertClosureRowsInTx(tx, nodes, parentOf, tenant); err != nil {
+			return err
+		}
+		if err := ct.setParentIDsInTx(tx, parentOf, tenant); err != nil {
+			return err
+		}
+		return ct.insertMetaRowsInTx(tx, nodes, parentOf, tenant)
+	})
+}
+
+type rebuildNode[K ID] struct {
+	NodeID    K
+	SortOrder float64
+}
+
+// currentParentsInTx returns the parent links stored in the depth 1 closure rows of a tenant.
+func (ct *TreeOf[K]) currentParentsInTx(tx *gorm.DB, tenant string) (map[K]K, error) {
+	var rows []closureTree[K]
+	err := tx.Table(ct.relationsTbl).Select("ancestor_id, descendant_id").
+		Where("tenant = ? AND depth = 1", tenant).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("rebuild: failed to load parent links: %w", err)
+	}
+	parents := make(map[K]K, len(rows))
+	for _, row := range rows {
+		if p, ok := parents[row.DescendantID]; ok && p != row.AncestorID {
+			return nil, fmt.Errorf("%w: node %v has the parents %v and %v", ErrInvalidAdjacency, row.DescendantID, p, row.AncestorID)
+		}
+		parents[row.DescendantID] = row.AncestorID
+	}
+	return parents, nil
+}
+
+// rebuildParents validates the parent links against the nodes of the tenant and returns the
+// parent of every node.
+func rebuildParents[K ID](nodes []rebuildNode[K], parents map[K]K) (map[K]K, error) {
+	parentOf := make(map[K]K, len(nodes))
+	for _, n := range nodes {
+		parentOf[n.NodeID] = parents[n.NodeID]
+	}
+	for id, parentID := range parents {
+		if _, ok := parentOf[id]; !ok {
+			return nil, fmt.Errorf("%w: %v", ErrNodeNotFound, id)
+		}
+		if _, ok := parentOf[parentID]; !isRoot(parentID) && !ok {
+			return nil, fmt.Errorf("%w: %v, parent of %v", ErrParentNotFound, parentID, id)
+		}
+	}
+	// walk up from every node, stopping at nodes already known to reach the root
+	reachesRoot := make(map[K]bool, len(nodes))
+	for _, n := range nodes {
+		var path []K
+		for id := n.NodeID; !isRoot(id) && !reachesRoot[id]; id = parentOf[id] {
+			if len(path) > len(nodes) {
+				return nil, fmt.Errorf("%w: node %v is its own ancestor", ErrInvalidAdjacency, n.NodeID)
+			}
+			path = append(path, id)
+		}
+		for _, id := range path {
+			reachesRoot[id] = true
+		}
+	}
+	return parentOf, nil
+}
+
+// insertClosureRowsInTx inserts the self row and one row per ancestor, including the root
+// sentinel, for every node.
+func (ct *TreeOf[K]) insertClosureRowsInTx(tx *gorm.DB, nodes []rebuildNode[K], parentOf map[K]K, tenant string) error {
+	rows := make([]closureTree[K], 0, rebuildBatchSize)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := tx.Table(ct.relationsTbl).Create(&rows).Error; err != nil {
+			return fmt.Errorf("rebuild: failed to insert closure rows: %w", err)
+		}
+		rows = rows[:0]
+		return nil
+	}
+	for _, n := range nodes {
+		rows = append(rows, closureTree[K]{AncestorID: n.NodeID, DescendantID: n.NodeID, Tenant: tenant})
+		depth := 0
+		for id := n.NodeID; !isRoot(id); {
+			id = parentOf[id]
+			depth++
+			rows = append(rows, closureTree[K]{AncestorID: id, DescendantID: n.NodeID, Tenant: tenant, Depth: depth})
+		}
+		if len(rows) >= rebuildBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// insertMetaRowsInTx inserts the meta row of every parent with children, with the halvings
+// remaining in the smallest gap between consecutive siblings.
+func (ct *TreeOf[K]) insertMetaRowsInTx(tx *gorm.DB, nodes []rebuildNode[K], parentOf map[K]K, tenant string) error {
+	children := map[K][]float64{}
+	for _, n := range nodes {
+		p := parentOf[n.NodeID]
+		children[p] = append(children[p], n.SortOrder)
+	}
+	rows := make([]closureTreeMeta[K], 0, len(children))
+	for parentID, orders := range children {
+		slices.Sort(orders)
+		halvings := 9999
+		for i := 1; i < len(orders); i++ {
+			halvings = min(halvings, halvingsRemaining(orders[i-1], orders[i]))
+		}
+		rows = append(rows, closureTreeMeta[K]{Tenant: tenant, ParentID: parentID, MinHalvings: halvings})
+	}
+	slices.SortFunc(rows, func(a, b closureTreeMeta[K]) int { return cmp.Compare(a.ParentID, b.ParentID) })
+	// insert with plain SQL, GORM would replace a zero min_halvings with the column default
+	for batch := range slices.Chunk(rows, rebuildBatchSize) {
+		values := make([]string, 0, len(batch))
+		args := make([]any, 0, 3*len(batch))
+		for _, row := range batch {
+			values = append(values, "(?, ?, ?)")
+			args = append(args, row.Tenant, row.ParentID, row.MinHalvings)
+		}
+		err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (tenant, parent_id, min_halvings) VALUES %s`,
+			ct.metaTbl, strings.Join(values, ", ")), args...).Error
+		if err != nil {
+			return fmt.Errorf("rebuild: failed to insert meta rows: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/gorm"
+)
+
+type closureRow struct {
+	AncestorID   uint
+	DescendantID uint
+	Depth        int
+}
+
+func closureRows(t *testing.T, gdb *gorm.DB, tenant string) []closureRow {
+	t.Helper()
+	var rows []closureRow
+	err := gdb.Table("closure_tree_rel_test_payloads").Where("tenant = ?", tenant).
+		Order("descendant_id, depth").Scan(&rows).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestRebuild(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			ctx := context.Background()
+			setup := func(t *testing.T) *closuretree.Tree {
+				dropTreeTables(gdb, TestPayload{})
+				ct, err := closuretree.New(gdb, TestPayload{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				populateTree(t, ct)
+				return ct
+			}
+			verify := func(t *testing.T, ct *closuretree.Tree) {
+				report, err := ct.Verify(ctx, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !report.OK() {
+					t.Errorf("unexpected problems after rebuild: %+v", report)
+				}
+			}
+
+			t.Run("from current parents", func(t *testing.T) {
+				ct := setup(t)
+				want := closureRows(t, gdb, tenant1)
+				other := closureRows(t, gdb, tenant2)
+				err := gdb.Exec("DELETE FROM closure_tree_rel_test_payloads WHERE tenant = ? AND depth <> 1", tenant1).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = gdb.Exec("INSERT INTO closure_tree_meta_test_payloads (tenant, parent_id, min_halvings) VALUES (?, 999, 1)", tenant1).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// siblings 2 and 4 share a sort order, no halvings remain between them
+				if err := gdb.Exec("UPDATE test_payloads SET sort_order = 5 WHERE node_id IN (2, 4)").Error; err != nil {
+					t.Fatal(err)
+				}
+
+				if err := ct.Rebuild(ctx, tenant1, nil); err != nil {
+					t.Fatal(err)
+				}
+				needs, err := ct.NeedsRenormalize(ctx, 1, tenant1, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !needs {
+					t.Error("expected the children of 1 to need a renormalize")
+				}
+				if diff := cmp.Diff(closureRows(t, gdb, tenant1), want); diff != "" {
+					t.Errorf("unexpected closure rows (-got +want):\n%s", diff)
+				}
+				if diff := cmp.Diff(closureRows(t, gdb, tenant2), other); diff != "" {
+					t.Errorf("unexpected closure rows of the other tenant (-got +want):\n%s", diff)
+				}
+				verify(t, ct)
+
+				var metaParents []uint
+				err = gdb.Table("closure_tree_meta_test_payloads").Where("tenant = ?", tenant1).
+					Order("parent_id").Pluck("parent_id", &metaParents).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(metaParents, []uint{0, 1, 2, 3}); diff != "" {
+					t.Errorf("unexpected meta rows (-got +want):\n%s", diff)
+				}
+			})
+
+			t.Run("from parent map", func(t *testing.T) {
+				ct := setup(t)
+				// 3 moves below 2 and 4 below 3, 1 is missing and stays at the root
+				parents := map[uint]uint{2: 1, 3: 2, 4: 3, 5: 3, 6: 2}
+				if err := ct.Rebuild(ctx, tenant1, parents); err != nil {
+					t.Fatal(err)
+				}
+				verify(t, ct)
+				got, err := ct.DescendantIds(ctx, 2, 0, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				slices.Sort(got)
+				if diff := cmp.Diff(got, []uint{3, 4, 5, 6}); diff != "" {
+					t.Errorf("unexpected descendants (-got +want):\n%s", diff)
+				}
+				roots, err := ct.DescendantIds(ctx, 0, 1, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(roots, []uint{1}); diff != "" {
+					t.Errorf("unexpected root nodes (-got +want):\n%s", diff)
+				}
+			})
+
+			tcs := []struct {
+				name    string
+				parents map[uint]uint
+				corrupt string
+				wantErr error
+			}{
+				{name: "cycle", parents: map[uint]uint{1: 2, 2: 1}, wantErr: closuretree.ErrInvalidAdjacency},
+				{name: "self parent", parents: map[uint]uint{3: 3}, wantErr: closuretree.ErrInvalidAdjacency},
+				{name: "unknown node", parents: map[uint]uint{99: 0}, wantErr: closuretree.ErrNodeNotFound},
+				{name: "node of other tenant", parents: map[uint]uint{7: 0}, wantErr: closuretree.ErrNodeNotFound},
+				{name: "unknown parent", parents: map[uint]uint{4: 99}, wantErr: closuretree.ErrParentNotFound},
+				{
+					name:    "two current parents",
+					corrupt: "INSERT INTO closure_tree_rel_test_payloads (ancestor_id, descendant_id, tenant, depth) VALUES (3, 6, ?, 1)",
+					wantErr: closuretree.ErrInvalidAdjacency,
+				},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					ct := setup(t)
+					if tc.corrupt != "" {
+						if err := gdb.Exec(tc.corrupt, tenant1).Error; err != nil {
+							t.Fatal(err)
+						}
+					}
+					want := closureRows(t, gdb, tenant1)
+					err := ct.Rebuild(ctx, tenant1, tc.parents)
+					if !errors.Is(err, tc.wantErr) {
+						t.Fatalf("expected %v, got %v", tc.wantErr, err)
+					}
+					if diff := cmp.Diff(closureRows(t, gdb, tenant1), want); diff != "" {
+						t.Errorf("closure rows changed on error (-got +want):\n%s", diff)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package closuretree
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// deleteTenantBatchSize is the number of nodes removed per transaction by DeleteTenant.
+const deleteTenantBatchSize = 500
+
+// TenantInfo holds the number of nodes a tenant owns in the tree.
+type TenantInfo struct {
+	Tenant string
+	Nodes  int64
+}
+
+// Tenants returns every tenant with at least one node, ordered by tenant.
+func (ct *TreeOf[K]) Tenants(ctx context.Context) ([]TenantInfo, error) {
+	tenants := []TenantInfo{}
+	err := ct.db.WithContext(ctx).Table(ct.nodesTbl).
+		Select("tenant, COUNT(*) AS nodes").
+		Group("tenant").
+		Order("tenant").
+		Scan(&tenants).Error
+	if err != nil {
+		return nil, fmt.Errorf("Tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// DeleteTenant removes all nodes of tenant together with their closure rows, sort-order metadata,
+// join rows of registered leaves and audit history.
+// To keep transactions small the nodes are deleted in batches, each in its own transaction; if a
+// batch fails the nodes deleted by previous batches stay deleted and DeleteTenant can be called again.
+// Lifecycle hooks are not called, a delete change event is recorded for every removed node.
+func (ct *TreeOf[K]) DeleteTenant(ctx context.Context, tenant string) error {
+	var err error
+	tenant, err = validateTenant(tenant)
+	if err != nil {
+		return err
+	}
+	db := ct.db.WithContext(ctx)
+	for {
+		var ids []K
+		err := db.Table(ct.nodesTbl).Where("tenant = ?", tenant).
+			Order("node_id").Limit(deleteTenantBatchSize).
+			Pluck("node_id", &ids).Error
+		if err != nil {
+			return fmt.Errorf("deleteTenant: failed to collect nodes: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return ct.deleteTenantBatchInTx(tx, ids, tenant)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ?`, ct.relationsTbl), tenant).Error; err != nil {
+			return fmt.Errorf("deleteTenant: failed to delete closure rows: %w", err)
+		}
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ?`, ct.metaTbl), tenant).Error; err != nil {
+			return fmt.Errorf("deleteTenant: failed to delete metadata: %w", err)
+		}
+		if ct.opts.History {
+			if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ?`, ct.historyTbl), tenant).Error; err != nil {
+				return fmt.Errorf("deleteTenant: failed to delete history: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// deleteTenantBatchInTx removes the nodes ids of tenant, the closure rows pointing at them and the
+// join rows of registered leaves. Closure rows of other descendants are removed with their own batch.
+func (ct *TreeOf[K]) deleteTenantBatchInTx(tx *gorm.DB, ids []K, tenant string) error {
+	for _, join := range ct.leaves {
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s IN ?`, join.joinTbl, join.nodeCol), ids).Error; err != nil {
+			return fmt.Errorf("deleteTenant: failed to detach leaves: %w", err)
+		}
+	}
+	if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ? AND descendant_id IN ?`, ct.relationsTbl),
+		tenant, ids).Error; err != nil {
+		return fmt.Errorf("deleteTenant: failed to delete closure rows: %w", err)
+	}
+	if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE tenant = ? AND node_id IN ?`, ct.nodesTbl),
+		tenant, ids).Error; err != nil {
+		return fmt.Errorf("deleteTenant: failed to delete nodes: %w", err)
+	}
+	events := make([]ChangeEventOf[K], 0, len(ids))
+	for _, id := range ids {
+		events = append(events, ChangeEventOf[K]{Op: EventDelete, Tenant: tenant, NodeID: id})
+	}
+	return ct.appendEvents(tx, events...)
+}
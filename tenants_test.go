@@ -0,0 +1,78 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTenants(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{History: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			populateTree(t, ct)
+			ctx := context.Background()
+
+			got, err := ct.Tenants(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []closuretree.TenantInfo{{Tenant: tenant1, Nodes: 6}, {Tenant: tenant2, Nodes: 8}}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("unexpected tenants (-got +want):\n%s", diff)
+			}
+
+			if err := ct.DeleteTenant(ctx, tenant1); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err = ct.Tenants(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = []closuretree.TenantInfo{{Tenant: tenant2, Nodes: 8}}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("unexpected tenants after delete (-got +want):\n%s", diff)
+			}
+
+			for _, tbl := range []string{ct.GetClosureTableName(), "closure_tree_meta_" + ct.GetNodeTableName(),
+				"closure_tree_history_" + ct.GetNodeTableName()} {
+				var count int64
+				if err := gdb.Table(tbl).Where("tenant = ?", tenant1).Count(&count).Error; err != nil {
+					t.Fatal(err)
+				}
+				if count != 0 {
+					t.Errorf("expected no %s rows left in %s, got %d", tenant1, tbl, count)
+				}
+			}
+
+			ids, err := ct.DescendantIds(ctx, 7, 0, tenant2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 5 {
+				t.Errorf("expected tenant2 to be untouched, got descendants %v", ids)
+			}
+			history, err := ct.History(ctx, 7, tenant2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 1 {
+				t.Errorf("expected tenant2 history to be kept, got %v", history)
+			}
+
+			if err := ct.DeleteTenant(ctx, ""); !errors.Is(err, closuretree.ErrEmptyTenant) {
+				t.Errorf("expected ErrEmptyTenant, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package closuretree
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// TransferSubtree moves the node nodeID and all its descendants from fromTenant to toTenant,
+// placing it under newParentID (0 for root) after the sibling afterNodeID (0 places it first).
+// The tenant is rewritten on the nodes, their closure rows and their sort-order metadata.
+//
+// The many2many join rows of the leaf models registered with RegisterLeaves are kept consistent:
+// with carryLeaves the leaves attached to the subtree move to toTenant as well, dropping their
+// attachments to nodes that stay in fromTenant; without it the leaves stay in fromTenant and are
+// detached from the transferred nodes.
+//
+// Every transferred node gets a transfer event with the source tenant in OldTenant, and its history
+// entries move to toTenant so History keeps the whole timeline. The move hooks are not called,
+// since the subtree leaves the tenant.
+func (ct *TreeOf[K]) TransferSubtree(ctx context.Context, nodeID K, fromTenant, toTenant string,
+	newParentID, afterNodeID K, carryLeaves bool) error {
+	var err error
+	if fromTenant, err = validateTenant(fromTenant); err != nil {
+		return err
+	}
+	if toTenant, err = validateTenant(toTenant); err != nil {
+		return err
+	}
+	if fromTenant == toTenant {
+		return fmt.Errorf("%w: source and target tenant are the same, use Update to move within a tenant", ErrInvalidMove)
+	}
+
+	return ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ct.lockSiblingsInTx(tx, newParentID, toTenant); err != nil {
+			return err
+		}
+		var ids []K
+		err := tx.Table(ct.relationsTbl).
+			Where("ancestor_id = ? AND tenant = ?", nodeID, fromTenant).
+			Order("depth, descendant_id").
+			Pluck("descendant_id", &ids).Error
+		if err != nil {
+			return fmt.Errorf("transferSubtree: failed to collect nodes: %w", err)
+		}
+		if len(ids) == 0 {
+			return ErrNodeNotFound
+		}
+		oldParentID, err := ct.parentIDInTx(tx, nodeID, fromTenant)
+		if err != nil {
+			return err
+		}
+		if !isRoot(newParentID) {
+			var count int64
+			err := tx.Table(ct.nodesTbl).Where("node_id = ? AND tenant = ?", newParentID, toTenant).Count(&count).Error
+			if err != nil {
+				return fmt.Errorf("unable to check parent node: %w", err)
+			}
+			if count == 0 {
+				return ErrParentNotFound
+			}
+		}
+
+		// detach the subtree from its ancestors, only internal closure rows are left
+		if err := tx.Exec(fmt.Sprintf(moveDeleteExternalPaths, ct.relationsTbl, ct.relationsTbl),
+			nodeID, fromTenant, fromTenant).Error; err != nil {
+			return err
+		}
+		if err := ct.rewriteTenantInTx(tx, nodeID, fromTenant, toTenant); err != nil {
+			return err
+		}
+		if err := ct.insertNewPathsInTx(tx, nodeID, newParentID, toTenant); err != nil {
+			return err
+		}
+		if err := ct.reorderInTx(tx, nodeID, afterNodeID, &newParentID, toTenant); err != nil {
+			return err
+		}
+		if err := ct.enforceConstraints(tx, nodeID, toTenant, true); err != nil {
+			return err
+		}
+		if err := ct.transferLeavesInTx(tx, nodeID, fromTenant, toTenant, carryLeaves); err != nil {
+			return err
+		}
+
+		if !ct.tracksChanges() {
+			return nil
+		}
+		if ct.opts.History {
+			if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET tenant = ? WHERE tenant = ? AND node_id IN (%s)`,
+				ct.historyTbl, fmt.Sprintf(subtreeIDsQuery, ct.relationsTbl)),
+				toTenant, fromTenant, nodeID, toTenant).Error; err != nil {
+				return fmt.Errorf("transferSubtree: failed to move history: %w", err)
+			}
+		}
+		events := make([]ChangeEventOf[K], 0, len(ids))
+		for _, id := range ids {
+			events = append(events, ChangeEventOf[K]{Op: EventTransfer, Tenant: toTenant, OldTenant: fromTenant, NodeID: id})
+		}
+		events[0].OldParentID = ptr(oldParentID)
+		events[0].NewParentID = ptr(newParentID)
+		return ct.recordChanges(ctx, tx, events, payloadSnapshots[K]{})
+	})
+}
+
+// subtreeIDsQuery selects the nodes of the subtree of a node from the closure table.
+const subtreeIDsQuery = `SELECT descendant_id FROM %s WHERE ancestor_id = ? AND tenant = ?`
+
+// rewriteTenantInTx changes the tenant of the subtree of nodeID: the nodes, their closure rows
+// and their sort-order metadata. The closure rows must already be detached from any ancestor
+// outside the subtree, they are rewritten last since they select the subtree.
+func (ct *TreeOf[K]) rewriteTenantInTx(tx *gorm.DB, nodeID K, fromTenant, toTenant string) error {
+	subtree := fmt.Sprintf(subtreeIDsQuery, ct.relationsTbl)
+	if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET tenant = ? WHERE tenant = ? AND node_id IN (%s)`, ct.nodesTbl, subtree),
+		toTenant, fromTenant, nodeID, fromTenant).Error; err != nil {
+		return fmt.Errorf("transferSubtree: failed to update nodes: %w", err)
+	}
+	if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET tenant = ? WHERE tenant = ? AND parent_id IN (%s)`, ct.metaTbl, subtree),
+		toTenant, fromTenant, nodeID, fromTenant).Error; err != nil {
+		return fmt.Errorf("transferSubtree: failed to update metadata: %w", err)
+	}
+	if err := tx.Exec(fmt.Sprintf(transferClosureQuery, ct.relationsTbl, ct.relationsTbl),
+		nodeID, fromTenant, toTenant, fromTenant).Error; err != nil {
+		return fmt.Errorf("transferSubtree: failed to update closure rows: %w", err)
+	}
+	return nil
+}
+
+// transferClosureQuery changes the tenant of the closure rows of a detached subtree.
+// Uses a CTE so MySQL 8.0+ can materialise the subtree before the UPDATE, like
+// moveDeleteExternalPaths.
+const transferClosureQuery = `
+WITH subtree AS (
+    SELECT descendant_id FROM %s WHERE ancestor_id = ? AND tenant = ?
+)
+UPDATE %s SET tenant = ?
+WHERE descendant_id IN (SELECT descendant_id FROM subtree)
+AND tenant = ?`
+
+// transferLeavesInTx updates the registered leaves attached to the subtree of nodeID, which is
+// already in toTenant.
+func (ct *TreeOf[K]) transferLeavesInTx(tx *gorm.DB, nodeID K, fromTenant, toTenant string, carryLeaves bool) error {
+	subtree := fmt.Sprintf(subtreeIDsQuery, ct.relationsTbl)
+	for _, join := range ct.leaves {
+		if !carryLeaves {
+			if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s IN (%s)`, join.joinTbl, join.nodeCol, subtree),
+				nodeID, toTenant).Error; err != nil {
+				return fmt.Errorf("transferSubtree: failed to detach leaves: %w", err)
+			}
+			continue
+		}
+
+		var leafIDs []uint
+		err := tx.Raw(fmt.Sprintf(`SELECT DISTINCT j.%s FROM %s j
+JOIN %s l ON l.%s = j.%s
+WHERE j.%s IN (%s) AND l.%s = ?`, join.leafCol, join.joinTbl, join.leafTbl, leafIDDBField, join.leafCol,
+			join.nodeCol, subtree, leafTenantDBField), nodeID, toTenant, fromTenant).Scan(&leafIDs).Error
+		if err != nil {
+			return fmt.Errorf("transferSubtree: failed to collect leaves: %w", err)
+		}
+		if len(leafIDs) == 0 {
+			continue
+		}
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s IN ? AND %s NOT IN (%s)`, join.joinTbl, join.leafCol, join.nodeCol, subtree),
+			leafIDs, nodeID, toTenant).Error; err != nil {
+			return fmt.Errorf("transferSubtree: failed to detach leaves from %s: %w", fromTenant, err)
+		}
+		if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s IN ?`, join.leafTbl, leafTenantDBField, leafIDDBField),
+			toTenant, leafIDs).Error; err != nil {
+			return fmt.Errorf("transferSubtree: failed to update leaves: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gorm.io/gorm"
+)
+
+func TestTransferSubtree(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			setup := func(t *testing.T) (*closuretree.Tree, *gorm.DB) {
+				t.Helper()
+				gdb := connAndClose(t, db)
+				gdb.Exec("DROP TABLE IF EXISTS test_leaf_nodes")
+				gdb.Exec("DROP TABLE IF EXISTS test_leafs")
+				dropTreeTables(gdb, TestPayload{})
+				ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{Events: true, History: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				populateTree(t, ct)
+				if err := gdb.AutoMigrate(&TestLeaf{}); err != nil {
+					t.Fatal(err)
+				}
+				if err := ct.RegisterLeaves(TestLeaf{}); err != nil {
+					t.Fatal(err)
+				}
+				return ct, gdb
+			}
+			// addLeaf creates a tenant1 leaf attached to the passed nodes.
+			addLeaf := func(t *testing.T, gdb *gorm.DB, name string, nodeIDs ...uint) *TestLeaf {
+				t.Helper()
+				leaf := &TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: name}
+				if err := gdb.Create(leaf).Error; err != nil {
+					t.Fatal(err)
+				}
+				for _, id := range nodeIDs {
+					node := &TestPayload{}
+					node.NodeId = id
+					if err := gdb.Model(leaf).Association("Nodes").Append(node); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return leaf
+			}
+			ctx := context.Background()
+
+			t.Run("moves the subtree under the target parent", func(t *testing.T) {
+				ct, _ := setup(t)
+				// Mobile Phones (2) with Touch Screen (6) goes under Colors (7), after Cold (10)
+				if err := ct.TransferSubtree(ctx, 2, tenant1, tenant2, 7, 10, false); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := ct.DescendantIds(ctx, 7, 1, tenant2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(got, []uint{10, 2, 8}); diff != "" {
+					t.Errorf("unexpected children of 7 (-got +want):\n%s", diff)
+				}
+				assertIsDirectChild(t, ct, 2, 6, tenant2)
+				assertNodeNameIs(t, ct, 6, tenant2, "Touch Screen")
+
+				got, err = ct.DescendantIds(ctx, 0, 0, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(got, []uint{1, 3, 4, 5}, cmpopts.SortSlices(func(a, b uint) bool { return a < b })); diff != "" {
+					t.Errorf("unexpected nodes left in tenant1 (-got +want):\n%s", diff)
+				}
+				err = ct.GetNode(ctx, 2, tenant1, &TestPayload{})
+				if !errors.Is(err, closuretree.ErrNodeNotFound) {
+					t.Errorf("expected ErrNodeNotFound in the source tenant, got %v", err)
+				}
+
+				events, err := ct.ReadEvents(ctx, 0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var transferred []string
+				for _, e := range events {
+					if e.Op == closuretree.EventTransfer {
+						transferred = append(transferred, fmt.Sprintf("%d %s->%s", e.NodeID, e.OldTenant, e.Tenant))
+					}
+				}
+				want := []string{"2 " + tenant1 + "->" + tenant2, "6 " + tenant1 + "->" + tenant2}
+				if diff := cmp.Diff(transferred, want); diff != "" {
+					t.Errorf("unexpected transfer events (-got +want):\n%s", diff)
+				}
+			})
+
+			t.Run("moves the history along", func(t *testing.T) {
+				ct, _ := setup(t)
+				if err := ct.TransferSubtree(ctx, 2, tenant1, tenant2, 7, 0, false); err != nil {
+					t.Fatal(err)
+				}
+				entries, err := ct.History(ctx, 6, tenant2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, e := range entries {
+					got = append(got, fmt.Sprintf("%s %s->%s", e.Op, e.OldTenant, e.Tenant))
+				}
+				want := []string{"add ->" + tenant2, "transfer " + tenant1 + "->" + tenant2}
+				if diff := cmp.Diff(got, want); diff != "" {
+					t.Errorf("unexpected history (-got +want):\n%s", diff)
+				}
+				entries, err = ct.History(ctx, 6, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 0 {
+					t.Errorf("expected no history left in the source tenant, got %v", entries)
+				}
+			})
+
+			t.Run("moves the subtree to root", func(t *testing.T) {
+				ct, _ := setup(t)
+				if err := ct.TransferSubtree(ctx, 3, tenant1, tenant2, 0, 0, false); err != nil {
+					t.Fatal(err)
+				}
+				got, err := ct.DescendantIds(ctx, 0, 1, tenant2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(got, []uint{3, 9, 7}); diff != "" {
+					t.Errorf("unexpected root nodes (-got +want):\n%s", diff)
+				}
+				assertIsDirectChild(t, ct, 3, 5, tenant2)
+			})
+
+			t.Run("carries the leaves along", func(t *testing.T) {
+				ct, gdb := setup(t)
+				shared := addLeaf(t, gdb, "shared", 6, 4)
+				if err := ct.TransferSubtree(ctx, 2, tenant1, tenant2, 7, 0, true); err != nil {
+					t.Fatal(err)
+				}
+
+				var leaves []TestLeaf
+				if err := ct.GetLeaves(ctx, &leaves, 2, 0, tenant2); err != nil {
+					t.Fatal(err)
+				}
+				if len(leaves) != 1 || leaves[0].Id() != shared.Id() {
+					t.Errorf("expected the shared leaf under 2 in tenant2, got %v", leaves)
+				}
+				leaves = nil
+				if err := ct.GetLeaves(ctx, &leaves, 1, 0, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if len(leaves) != 0 {
+					t.Errorf("expected the leaf to be detached from tenant1 nodes, got %v", leaves)
+				}
+			})
+
+			t.Run("leaves stay in the source tenant", func(t *testing.T) {
+				ct, gdb := setup(t)
+				shared := addLeaf(t, gdb, "shared", 6, 4)
+				if err := ct.TransferSubtree(ctx, 2, tenant1, tenant2, 7, 0, false); err != nil {
+					t.Fatal(err)
+				}
+
+				var leaves []TestLeaf
+				if err := ct.GetLeaves(ctx, &leaves, 1, 0, tenant1); err != nil {
+					t.Fatal(err)
+				}
+				if len(leaves) != 1 || leaves[0].Id() != shared.Id() {
+					t.Errorf("expected the shared leaf to stay under 1 in tenant1, got %v", leaves)
+				}
+				leaves = nil
+				if err := ct.GetLeaves(ctx, &leaves, 2, 0, tenant2); err != nil {
+					t.Fatal(err)
+				}
+				if len(leaves) != 0 {
+					t.Errorf("expected no leaves under the transferred nodes, got %v", leaves)
+				}
+			})
+
+			t.Run("errors", func(t *testing.T) {
+				ct, _ := setup(t)
+				tcs := []struct {
+					name     string
+					nodeID   uint
+					from, to string
+					parentID uint
+					wantErr  error
+				}{
+					{name: "same tenant", nodeID: 2, from: tenant1, to: tenant1, wantErr: closuretree.ErrInvalidMove},
+					{name: "node in other tenant", nodeID: 7, from: tenant1, to: tenant2, wantErr: closuretree.ErrNodeNotFound},
+					{name: "parent in source tenant", nodeID: 2, from: tenant1, to: tenant2, parentID: 1, wantErr: closuretree.ErrParentNotFound},
+				}
+				for _, tc := range tcs {
+					t.Run(tc.name, func(t *testing.T) {
+						err := ct.TransferSubtree(ctx, tc.nodeID, tc.from, tc.to, tc.parentID, 0, false)
+						if !errors.Is(err, tc.wantErr) {
+							t.Errorf("expected %v, got %v", tc.wantErr, err)
+						}
+					})
+				}
+				assertIsDirectChild(t, ct, 1, 2, tenant1)
+			})
+		})
+	}
+}
+
+func TestTransferLargeSubtree(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			gdb.Exec("DROP TABLE IF EXISTS test_leaf_nodes")
+			gdb.Exec("DROP TABLE IF EXISTS test_leafs")
+			dropTreeTables(gdb, TestPayload{})
+			ctx := context.Background()
+			ct, err := closuretree.NewWithOptions(gdb, TestPayload{}, closuretree.Options{Events: true, History: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.AutoMigrate(&TestLeaf{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.RegisterLeaves(TestLeaf{}); err != nil {
+				t.Fatal(err)
+			}
+			top := populateLargeSubtree(t, gdb, ct)
+			ids, err := ct.DescendantIds(ctx, top, 0, tenant1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := ids[len(ids)-1]
+			if err := ct.Update(ctx, last, TestPayload{Name: "last"}, nil, nil, tenant1); err != nil {
+				t.Fatal(err)
+			}
+			leaf := TestLeaf{Leaf: closuretree.Leaf{Tenant: tenant1}, Name: "deep"}
+			if err := gdb.Create(&leaf).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.SetLeafNodes(ctx, TestLeaf{}, leaf.Id(), []uint{last}, tenant1); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ct.TransferSubtree(ctx, top, tenant1, tenant2, 0, 0, true); err != nil {
+				t.Fatal(err)
+			}
+			ids, err = ct.DescendantIds(ctx, top, 0, tenant2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != largeSubtreeSize-1 {
+				t.Errorf("expected %d descendants in %s, got %d", largeSubtreeSize-1, tenant2, len(ids))
+			}
+			for _, tenant := range []string{tenant1, tenant2} {
+				report, err := ct.Verify(ctx, tenant)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !report.OK() {
+					t.Errorf("unexpected integrity problems in %s %+v", tenant, report)
+				}
+			}
+			history, err := ct.History(ctx, last, tenant2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 2 || history[1].Op != closuretree.EventTransfer {
+				t.Errorf("expected the update and transfer of %d in %s, got %+v", last, tenant2, history)
+			}
+			var got TestLeaf
+			if err := gdb.First(&got, leaf.Id()).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Tenant != tenant2 {
+				t.Errorf("expected the leaf to move to %s, got %s", tenant2, got.Tenant)
+			}
+		})
+	}
+}
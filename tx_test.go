@@ -0,0 +1,92 @@
+package closuretree_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"gorm.io/gorm"
+)
+
+type TxBook struct {
+	ID   uint `gorm:"primarykey"`
+	Name string
+}
+
+func TestRunInTx(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			dropTreeTables(gdb, TestPayload{})
+			gdb.Exec("DROP TABLE IF EXISTS tx_books")
+			ct, err := closuretree.New(gdb, TestPayload{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := gdb.AutoMigrate(&TxBook{}); err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			countAll := func(t *testing.T) (int, int64) {
+				t.Helper()
+				ids, err := ct.DescendantIds(ctx, 0, 0, tenant1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var books int64
+				if err := gdb.Model(&TxBook{}).Count(&books).Error; err != nil {
+					t.Fatal(err)
+				}
+				return len(ids), books
+			}
+
+			t.Run("error rolls back all tree operations", func(t *testing.T) {
+				errAbort := errors.New("abort")
+				err := ct.RunInTx(ctx, func(tree *closuretree.Tree) error {
+					fiction := &TestPayload{Name: "fiction"}
+					if err := tree.Add(ctx, fiction, 0, 0, tenant1); err != nil {
+						return err
+					}
+					if err := tree.Add(ctx, &TestPayload{Name: "fantasy"}, fiction.Id(), 0, tenant1); err != nil {
+						return err
+					}
+					return errAbort
+				})
+				if !errors.Is(err, errAbort) {
+					t.Fatalf("expected errAbort, got %v", err)
+				}
+				nodes, books := countAll(t)
+				if nodes != 0 || books != 0 {
+					t.Errorf("expected everything rolled back, got %d nodes and %d books", nodes, books)
+				}
+			})
+
+			t.Run("with an outer gorm transaction", func(t *testing.T) {
+				err := gdb.Transaction(func(tx *gorm.DB) error {
+					if err := tx.Create(&TxBook{Name: "Dune"}).Error; err != nil {
+						return err
+					}
+					tree := ct.WithTx(tx)
+					if err := tree.Add(ctx, &TestPayload{Name: "sci-fi"}, 0, 0, tenant1); err != nil {
+						return err
+					}
+					// a failed operation only rolls back its own savepoint
+					if err := tree.Add(ctx, &TestPayload{Name: "orphan"}, 999, 0, tenant1); !errors.Is(err, closuretree.ErrParentNotFound) {
+						t.Errorf("expected ErrParentNotFound, got %v", err)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				nodes, books := countAll(t)
+				if nodes != 1 || books != 1 {
+					t.Errorf("expected 1 node and 1 book, got %d nodes and %d books", nodes, books)
+				}
+			})
+		})
+	}
+}
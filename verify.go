@@ -0,0 +1,202 @@
+package closuretree
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// ReportOf lists the integrity problems found by Verify in a tenant, every field holds the
+// offending node IDs in ascending order. A zero ReportOf means no problem was found.
+type ReportOf[K ID] struct {
+	// MissingSelfRows are nodes without their depth 0 closure row.
+	MissingSelfRows []K
+	// NoParent are nodes without a depth 1 closure row, root nodes have the root sentinel as parent.
+	NoParent []K
+	// MultipleParents are nodes with more than one depth 1 closure row.
+	MultipleParents []K
+	// InconsistentPaths are nodes whose ancestor rows do not match the ones of their parent
+	// plus one level, e.g. a missing ancestor, a wrong depth or a node being its own ancestor.
+	InconsistentPaths []K
+	// MissingNodes are IDs referenced by closure rows of the tenant that have no node row.
+	MissingNodes []K
+	// TenantMismatches are IDs referenced by closure rows of the tenant whose node belongs to
+	// another tenant.
+	TenantMismatches []K
+	// StaleMeta are parent IDs of sort order metadata rows whose node does not exist.
+	StaleMeta []K
+	// ParentMismatches are nodes whose stored parent_id differs from their depth 1 closure row,
+	// only checked with Options.StoreParentID.
+	ParentMismatches []K
+}
+
+// Report is the ReportOf of trees with uint IDs.
+type Report = ReportOf[uint]
+
+// OK returns true if the report holds no problem.
+func (r ReportOf[K]) OK() bool {
+	return len(r.MissingSelfRows) == 0 && len(r.NoParent) == 0 && len(r.MultipleParents) == 0 &&
+		len(r.InconsistentPaths) == 0 && len(r.MissingNodes) == 0 && len(r.TenantMismatches) == 0 &&
+		len(r.StaleMeta) == 0 && len(r.ParentMismatches) == 0
+}
+
+// Verify checks the integrity of the node, closure and meta tables of a tenant, e.g. after
+// manual changes in the database, and reports the offending IDs. Verify does not modify data,
+// problems are reported in the Report and not as an error.
+func (ct *TreeOf[K]) Verify(ctx context.Context, tenant string) (ReportOf[K], error) {
+	tenant, err := validateTenant(tenant)
+	if err != nil {
+		return ReportOf[K]{}, err
+	}
+	var root K
+	var report ReportOf[K]
+	checks := []verifyCheck[K]{
+		{
+			name: "self rows", dst: &report.MissingSelfRows,
+			query: fmt.Sprintf(verifySelfRowsQuery, ct.nodesTbl, ct.relationsTbl),
+			args:  []any{tenant},
+		},
+		{
+			name: "missing parents", dst: &report.NoParent,
+			query: fmt.Sprintf(verifyParentCountQuery, ct.nodesTbl, ct.relationsTbl, "= 0"),
+			args:  []any{tenant},
+		},
+		{
+			name: "multiple parents", dst: &report.MultipleParents,
+			query: fmt.Sprintf(verifyParentCountQuery, ct.nodesTbl, ct.relationsTbl, "> 1"),
+			args:  []any{tenant},
+		},
+		{
+			name: "extra ancestors", dst: &report.InconsistentPaths,
+			query: fmt.Sprintf(verifyExtraAncestorsQuery, ct.relationsTbl, ct.relationsTbl, ct.relationsTbl),
+			args:  []any{tenant},
+		},
+		{
+			name: "missing ancestors", dst: &report.InconsistentPaths,
+			query: fmt.Sprintf(verifyMissingAncestorsQuery, ct.relationsTbl, ct.relationsTbl, ct.relationsTbl),
+			args:  []any{tenant},
+		},
+		{
+			name: "self depth", dst: &report.InconsistentPaths,
+			query: fmt.Sprintf(verifySelfDepthQuery, ct.relationsTbl),
+			args:  []any{tenant},
+		},
+		{
+			name: "missing nodes", dst: &report.MissingNodes,
+			query: fmt.Sprintf(verifyRowNodesQuery, ct.relationsTbl, ct.nodesTbl, "n.node_id IS NULL",
+				ct.relationsTbl, ct.nodesTbl, "n.node_id IS NULL"),
+			args: []any{tenant, tenant, root},
+		},
+		{
+			name: "tenant mismatches", dst: &report.TenantMismatches,
+			query: fmt.Sprintf(verifyRowNodesQuery, ct.relationsTbl, ct.nodesTbl, "n.tenant <> r.tenant",
+				ct.relationsTbl, ct.nodesTbl, "n.tenant <> r.tenant"),
+			args: []any{tenant, tenant, root},
+		},
+		{
+			name: "stale meta", dst: &report.StaleMeta,
+			query: fmt.Sprintf(verifyStaleMetaQuery, ct.metaTbl, ct.nodesTbl),
+			args:  []any{tenant, root},
+		},
+	}
+	if ct.opts.StoreParentID {
+		checks = append(checks, verifyCheck[K]{
+			name: "stored parents", dst: &report.ParentMismatches,
+			query: fmt.Sprintf(verifyStoredParentQuery, ct.nodesTbl, ct.relationsTbl),
+			args:  []any{tenant},
+		})
+	}
+	err = ct.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, check := range checks {
+			var ids []K
+			if err := tx.Raw(check.query, check.args...).Scan(&ids).Error; err != nil {
+				return fmt.Errorf("verify: %s: %w", check.name, err)
+			}
+			*check.dst = append(*check.dst, ids...)
+		}
+		return nil
+	})
+	if err != nil {
+		return ReportOf[K]{}, err
+	}
+	for _, ids := range []*[]K{
+		&report.MissingSelfRows, &report.NoParent, &report.MultipleParents, &report.InconsistentPaths,
+		&report.MissingNodes, &report.TenantMismatches, &report.StaleMeta, &report.ParentMismatches,
+	} {
+		slices.Sort(*ids)
+		*ids = slices.Compact(*ids)
+	}
+	return report, nil
+}
+
+// verifyCheck is a query selecting offending IDs, appended to dst.
+type verifyCheck[K ID] struct {
+	name  string
+	dst   *[]K
+	query string
+	args  []any
+}
+
+// verifySelfRowsQuery selects the nodes without a depth 0 closure row.
+const verifySelfRowsQuery = `SELECT n.node_id FROM %s n
+WHERE n.tenant = ? AND NOT EXISTS (
+	SELECT 1 FROM %s r
+	WHERE r.ancestor_id = n.node_id AND r.descendant_id = n.node_id AND r.depth = 0 AND r.tenant = n.tenant
+)`
+
+// verifyParentCountQuery selects the nodes whose number of depth 1 closure rows matches the
+// condition appended to the HAVING clause.
+const verifyParentCountQuery = `SELECT n.node_id FROM %s n
+LEFT JOIN %s r ON r.descendant_id = n.node_id AND r.depth = 1 AND r.tenant = n.tenant
+WHERE n.tenant = ?
+GROUP BY n.node_id
+HAVING COUNT(r.ancestor_id) %s`
+
+// verifyExtraAncestorsQuery selects the nodes with an ancestor row at depth >= 2 that has no
+// matching row one level up, from the same ancestor to the parent.
+const verifyExtraAncestorsQuery = `SELECT DISTINCT r.descendant_id FROM %s r
+JOIN %s p ON p.descendant_id = r.descendant_id AND p.depth = 1 AND p.tenant = r.tenant
+WHERE r.tenant = ? AND r.depth >= 2 AND NOT EXISTS (
+	SELECT 1 FROM %s x
+	WHERE x.ancestor_id = r.ancestor_id AND x.descendant_id = p.ancestor_id
+	  AND x.depth = r.depth - 1 AND x.tenant = r.tenant
+)`
+
+// verifyMissingAncestorsQuery selects the nodes missing the row to an ancestor of their parent,
+// one level deeper than the row of the parent.
+const verifyMissingAncestorsQuery = `SELECT DISTINCT p.descendant_id FROM %s p
+JOIN %s x ON x.descendant_id = p.ancestor_id AND x.depth >= 1 AND x.tenant = p.tenant
+WHERE p.tenant = ? AND p.depth = 1 AND NOT EXISTS (
+	SELECT 1 FROM %s r
+	WHERE r.ancestor_id = x.ancestor_id AND r.descendant_id = p.descendant_id
+	  AND r.depth = x.depth + 1 AND r.tenant = p.tenant
+)`
+
+// verifySelfDepthQuery selects the nodes with a depth 0 row to another node or a deeper row to
+// themselves, i.e. a cycle.
+const verifySelfDepthQuery = `SELECT DISTINCT descendant_id FROM %s
+WHERE tenant = ? AND ((depth = 0 AND ancestor_id <> descendant_id) OR (depth > 0 AND ancestor_id = descendant_id))`
+
+// verifyRowNodesQuery selects the IDs referenced by the closure rows of a tenant, as ancestor
+// or descendant, whose node matches the condition.
+const verifyRowNodesQuery = `SELECT r.descendant_id FROM %s r
+LEFT JOIN %s n ON n.node_id = r.descendant_id
+WHERE r.tenant = ? AND %s
+UNION
+SELECT r.ancestor_id FROM %s r
+LEFT JOIN %s n ON n.node_id = r.ancestor_id
+WHERE r.tenant = ? AND r.ancestor_id <> ? AND %s`
+
+// verifyStaleMetaQuery selects the parent IDs of meta rows without a node.
+const verifyStaleMetaQuery = `SELECT m.parent_id FROM %s m
+WHERE m.tenant = ? AND m.parent_id <> ? AND NOT EXISTS (
+	SELECT 1 FROM %s n WHERE n.node_id = m.parent_id AND n.tenant = m.tenant
+)`
+
+// verifyStoredParentQuery selects the nodes whose parent_id column differs from the depth 1
+// closure row, nodes without one are reported by verifyParentCountQuery.
+const verifyStoredParentQuery = `SELECT DISTINCT n.node_id FROM %s n
+JOIN %s r ON r.descendant_id = n.node_id AND r.depth = 1 AND r.tenant = n.tenant
+WHERE n.tenant = ? AND r.ancestor_id <> n.parent_id`
@@ -0,0 +1,115 @@
+package closuretree_test
+
+import (
+	"context"
+	"testing"
+
+	closuretree "github.com/go-bumbu/closure-tree"
+	"github.com/go-bumbu/testdbs"
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/gorm"
+)
+
+func TestVerify(t *testing.T) {
+	for _, db := range testdbs.DBs() {
+		t.Run(db.DbType(), func(t *testing.T) {
+			gdb := connAndClose(t, db)
+			ctx := context.Background()
+			rel := "closure_tree_rel_test_payloads"
+
+			tcs := []struct {
+				name    string
+				corrupt func(ct *closuretree.Tree, db *gorm.DB) error
+				want    closuretree.Report
+			}{
+				{name: "consistent", corrupt: func(ct *closuretree.Tree, db *gorm.DB) error { return nil }},
+				{
+					name: "after delete",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return ct.DeleteRecurse(ctx, 1, tenant1)
+					},
+				},
+				{
+					name: "missing self row",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("DELETE FROM " + rel + " WHERE ancestor_id = 4 AND descendant_id = 4").Error
+					},
+					want: closuretree.Report{MissingSelfRows: []uint{4}},
+				},
+				{
+					name: "no parent",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("DELETE FROM " + rel + " WHERE ancestor_id = 3 AND descendant_id = 5").Error
+					},
+					want: closuretree.Report{NoParent: []uint{5}},
+				},
+				{
+					name: "second parent",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("INSERT INTO "+rel+" (ancestor_id, descendant_id, tenant, depth) VALUES (3, 6, ?, 1)", tenant1).Error
+					},
+					want: closuretree.Report{MultipleParents: []uint{6}, InconsistentPaths: []uint{6}},
+				},
+				{
+					name: "missing ancestor",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("DELETE FROM " + rel + " WHERE ancestor_id = 0 AND descendant_id = 6").Error
+					},
+					want: closuretree.Report{InconsistentPaths: []uint{6}},
+				},
+				{
+					name: "cycle",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("UPDATE " + rel + " SET depth = 1 WHERE ancestor_id = 4 AND descendant_id = 4").Error
+					},
+					want: closuretree.Report{MissingSelfRows: []uint{4}, MultipleParents: []uint{4}, InconsistentPaths: []uint{4}},
+				},
+				{
+					name: "missing node",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("DELETE FROM test_payloads WHERE node_id = 6").Error
+					},
+					want: closuretree.Report{MissingNodes: []uint{6}},
+				},
+				{
+					name: "tenant mismatch",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("UPDATE test_payloads SET tenant = ? WHERE node_id = 4", tenant2).Error
+					},
+					want: closuretree.Report{TenantMismatches: []uint{4}},
+				},
+				{
+					name: "stale meta",
+					corrupt: func(ct *closuretree.Tree, db *gorm.DB) error {
+						return db.Exec("INSERT INTO closure_tree_meta_test_payloads (tenant, parent_id, min_halvings) VALUES (?, 999, 9999)", tenant1).Error
+					},
+					want: closuretree.Report{StaleMeta: []uint{999}},
+				},
+			}
+			for _, tc := range tcs {
+				t.Run(tc.name, func(t *testing.T) {
+					dropTreeTables(gdb, TestPayload{})
+					ct, err := closuretree.New(gdb, TestPayload{})
+					if err != nil {
+						t.Fatal(err)
+					}
+					populateTree(t, ct)
+					if err := tc.corrupt(ct, gdb); err != nil {
+						t.Fatal(err)
+					}
+
+					got, err := ct.Verify(ctx, tenant1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if diff := cmp.Diff(got, tc.want); diff != "" {
+						t.Errorf("unexpected report (-got +want):\n%s", diff)
+					}
+					if got.OK() != tc.want.OK() {
+						t.Errorf("unexpected OK() = %v", got.OK())
+					}
+				})
+			}
+		})
+	}
+}